@@ -0,0 +1,155 @@
+package batchy
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidWorkerRange is returned when MinWorkers is negative or larger than MaxWorkers
+	ErrInvalidWorkerRange = errors.New("MinWorkers must be between 0 and MaxWorkers")
+	// ErrAutoscaleUnsupported is returned when MaxWorkers is set for a batcher
+	// whose worker count is fixed by its scheduling policy or by keyed batching
+	ErrAutoscaleUnsupported = errors.New("autoscaling requires ROUND_ROBIN scheduling and is not supported by keyed batchers")
+)
+
+const (
+	defaultScaleInterval = time.Second
+	defaultScaleDownIdle = 30 * time.Second
+	// scaleUpOccupancy is the queue fill ratio above which workers are added
+	scaleUpOccupancy = 0.5
+	// scaleUpLoad is the share of the interval the workers must have spent in
+	// the processor before more of them are added
+	scaleUpLoad = 0.8
+	// scaleDownLoad is the load the remaining workers may carry once one of
+	// them has been retired
+	scaleDownLoad = 0.5
+)
+
+// workerRange returns the bounds autoscaling keeps the worker count within
+func workerRange(cfg BatchConfig) (lo, hi int, err error) {
+	lo = cfg.MinWorkers
+	if lo == 0 {
+		lo = 1
+	}
+	if lo < 0 || lo > cfg.MaxWorkers {
+		return 0, 0, ErrInvalidWorkerRange
+	}
+	return lo, cfg.MaxWorkers, nil
+}
+
+// scaleState is what the supervisor remembers between two samples
+type scaleState struct {
+	busy      time.Duration // Processor time recorded up to the last sample
+	sampled   time.Time
+	idleSince time.Time // Start of the current idle period, zero while busy
+}
+
+// autoscale samples queue pressure and processor load every ScaleInterval and
+// adds or retires workers accordingly, until the batcher stops
+func (c *ChanBatcherInstance[T]) autoscale() {
+	s := scaleState{busy: c.stats.busyTime(), sampled: time.Now()}
+	timer := time.NewTimer(c.scaleInterval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.closing:
+			return
+		case now := <-timer.C:
+			if from, to := c.scaleStep(&s, now); from != to {
+				c.scaled(from, to)
+			}
+			timer.Reset(c.scaleInterval())
+		}
+	}
+}
+
+func (c *ChanBatcherInstance[T]) scaleInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.config.ScaleInterval > 0 {
+		return c.config.ScaleInterval
+	}
+	return defaultScaleInterval
+}
+
+// scaleStep takes one sample and resizes the pool when needed. Workers are
+// added while the queue stays full and the processors are saturated, one is
+// retired after ScaleDownIdle of spare capacity.
+func (c *ChanBatcherInstance[T]) scaleStep(s *scaleState, now time.Time) (from, to int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lo, hi, err := workerRange(c.config)
+	if err != nil {
+		return 0, 0
+	}
+
+	// Average number of workers running the processor since the last sample
+	busy := c.stats.busyTime()
+	load := float64(busy-s.busy) / float64(max(now.Sub(s.sampled), 1))
+	s.busy, s.sampled = busy, now
+
+	from = c.workerCount
+	to = min(max(from, lo), hi)
+	length, capacity := c.queueDepth()
+	spilled := c.spilled() > 0
+	backlog := length > 0 || spilled
+	pressure := spilled ||
+		(capacity > 0 && float64(length) >= scaleUpOccupancy*float64(capacity))
+	saturated := load >= scaleUpLoad*float64(from) || int(c.stats.inFlight.Load()) >= from
+
+	switch {
+	case pressure && saturated:
+		to = min(from+max(from/4, 1), hi)
+		s.idleSince = time.Time{}
+	case !backlog && load <= scaleDownLoad*float64(from-1):
+		idle := c.config.ScaleDownIdle
+		if idle <= 0 {
+			idle = defaultScaleDownIdle
+		}
+		if s.idleSince.IsZero() {
+			s.idleSince = now
+		} else if now.Sub(s.idleSince) >= idle && to == from && from > lo {
+			to = from - 1
+			// Another idle period has to pass before the next one goes
+			s.idleSince = now
+		}
+	default:
+		s.idleSince = time.Time{}
+	}
+	if to == from {
+		return from, to
+	}
+
+	// Workers must not be started once Shutdown() waits for them to exit
+	c.intakeMu.RLock()
+	defer c.intakeMu.RUnlock()
+	select {
+	case <-c.closing:
+		return from, from
+	case <-c.ctx.Done():
+		return from, from
+	default:
+	}
+	if err := c.resize(to); err != nil {
+		return from, from
+	}
+	c.config.PoolSize = to
+	return from, to
+}
+
+// scaled reports a change of the worker count to the OnScale hook. A panic is
+// passed to OnPanic with workerID -1.
+func (c *ChanBatcherInstance[T]) scaled(from, to int) {
+	if c.onScale == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c.reportPanic(-1, newPanicError(r))
+		}
+	}()
+	c.onScale(from, to)
+}
@@ -0,0 +1,50 @@
+package batchy
+
+import (
+	"context"
+	"time"
+)
+
+// Batch is one processor invocation handed to a ContextProcessor. Items and
+// EnqueuedAt are reused by the worker and only valid until the processor
+// returns.
+type Batch[T any] struct {
+	// ID identifies the invocation, a retried item is part of a new batch
+	ID uint64
+	// WorkerID is the worker running the batch
+	WorkerID int
+	// Trigger is why the batch was emitted
+	Trigger FlushTrigger
+	// Items are the items to process
+	Items []T
+	// EnqueuedAt holds when each item was accepted, in the order of Items
+	EnqueuedAt []time.Time
+}
+
+// ContextProcessor is a Processor that also receives a context and the batch
+// metadata. The context ends when the batcher is stopped or ProcessTimeout
+// elapses, and carries the batch span when the tracer is a BatchContextTracer.
+type ContextProcessor[T any] func(ctx context.Context, batch Batch[T]) []error
+
+// contextProcessor adapts a plain Processor, which ignores the context
+func contextProcessor[T any](p Processor[T]) ContextProcessor[T] {
+	if p == nil {
+		return nil
+	}
+	return func(_ context.Context, batch Batch[T]) []error {
+		return p(batch.Items)
+	}
+}
+
+// NewChanBatcherContext 创建阻塞式批处理器，处理器可感知关闭和超时并获取批次信息
+func NewChanBatcherContext[T any](
+	processor ContextProcessor[T],
+	batchConfig BatchConfig,
+	opts ...Option[T],
+) (Batcher[T], error) {
+	instance, err := newChanBatcher(processor, batchConfig, buildOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
@@ -0,0 +1,236 @@
+package batchy
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidFailureRatio is returned when BreakerConfig.FailureRatio is outside [0, 1]
+var ErrInvalidFailureRatio = errors.New("breaker failure ratio must be between 0 and 1")
+
+const (
+	defaultBreakerWindow      = 10
+	defaultBreakerOpenTimeout = 5 * time.Second
+)
+
+// BreakerState is the state of the circuit breaker around the processor
+type BreakerState int32
+
+const (
+	// BREAKER_CLOSED batches go to the processor
+	BREAKER_CLOSED BreakerState = iota
+	// BREAKER_OPEN the downstream is failing, batches are held or go to the fallback
+	BREAKER_OPEN
+	// BREAKER_HALF_OPEN one probe batch at a time tests whether the downstream recovered
+	BREAKER_HALF_OPEN
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BREAKER_CLOSED:
+		return "closed"
+	case BREAKER_OPEN:
+		return "open"
+	case BREAKER_HALF_OPEN:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig configures the circuit breaker, see BatchConfig.Breaker
+type BreakerConfig struct {
+	// FailureRatio 最近Window个批次中失败数据的比例达到该值时熔断，0表示不启用熔断器
+	FailureRatio float64
+	// Window 计算失败比例的最近批次数，默认10
+	Window int
+	// OpenTimeout 熔断后经过多久放行试探批次，默认5秒
+	OpenTimeout time.Duration
+	// HalfOpenBatches 半开状态下连续成功多少个试探批次后恢复，默认1
+	HalfOpenBatches int
+	// OnStateChange 熔断器状态变化时在worker协程中调用
+	OnStateChange func(from, to BreakerState)
+}
+
+// WithFallback sets the processor that receives batches while the circuit
+// breaker is open. Without a fallback workers hold their batch until the
+// breaker lets a probe through, so the queue fills up and Add blocks or
+// overflows according to OverflowPolicy.
+func WithFallback[T any](fallback Processor[T]) Option[T] {
+	return func(o *options[T]) {
+		o.fallback = fallback
+	}
+}
+
+// breakerSample is the outcome of one processor call
+type breakerSample struct {
+	items  int
+	failed int
+}
+
+// breaker tracks the failure ratio of recent batches across all workers.
+// Opening it is decided by the batches, leaving the open state by time: the
+// first worker that asks after OpenTimeout becomes the probe.
+type breaker struct {
+	ratio           float64
+	openTimeout     time.Duration
+	halfOpenBatches int
+
+	state atomic.Int32 // BreakerState, read by Stats without the lock
+
+	mu        sync.Mutex
+	window    []breakerSample // Ring of the most recent closed-state batches
+	next      int
+	filled    int
+	openUntil time.Time
+	probing   bool // A probe batch is running
+	successes int  // Successful probes since the breaker went half-open
+	// Closed and replaced when a probe finishes, wakes held workers
+	changed chan struct{}
+}
+
+func newBreaker(cfg BreakerConfig) *breaker {
+	window := cfg.Window
+	if window <= 0 {
+		window = defaultBreakerWindow
+	}
+	openTimeout := cfg.OpenTimeout
+	if openTimeout <= 0 {
+		openTimeout = defaultBreakerOpenTimeout
+	}
+	return &breaker{
+		ratio:           cfg.FailureRatio,
+		openTimeout:     openTimeout,
+		halfOpenBatches: max(cfg.HalfOpenBatches, 1),
+		window:          make([]breakerSample, window),
+		changed:         make(chan struct{}),
+	}
+}
+
+// breakerTransition is a state change to report once the lock is released,
+// from == to means there was none
+type breakerTransition struct {
+	from, to BreakerState
+}
+
+// setState switches to s, must be called with mu held
+func (b *breaker) setState(s BreakerState) breakerTransition {
+	from := BreakerState(b.state.Swap(int32(s)))
+	return breakerTransition{from: from, to: s}
+}
+
+// acquire asks whether a batch may go to the processor now. A denied caller
+// should retry after wait (when positive) or once changed is closed.
+func (b *breaker) acquire(now time.Time) (ok, probe bool, wait time.Duration, changed <-chan struct{}, tr breakerTransition) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch BreakerState(b.state.Load()) {
+	case BREAKER_CLOSED:
+		return true, false, 0, nil, tr
+	case BREAKER_OPEN:
+		if now.Before(b.openUntil) {
+			return false, false, b.openUntil.Sub(now), b.changed, tr
+		}
+		tr = b.setState(BREAKER_HALF_OPEN)
+		b.successes = 0
+	}
+	if b.probing {
+		return false, false, 0, b.changed, tr
+	}
+	b.probing = true
+	return true, true, 0, nil, tr
+}
+
+// record feeds the outcome of a processor call back into the breaker
+func (b *breaker) record(now time.Time, items, failed int, probe bool) (tr breakerTransition) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failing := float64(failed) >= b.ratio*float64(items)
+	if probe {
+		b.probing = false
+		close(b.changed)
+		b.changed = make(chan struct{})
+		if failing {
+			return b.open(now)
+		}
+		if b.successes++; b.successes >= b.halfOpenBatches {
+			clear(b.window)
+			b.next, b.filled = 0, 0
+			return b.setState(BREAKER_CLOSED)
+		}
+		return tr
+	}
+	if BreakerState(b.state.Load()) != BREAKER_CLOSED {
+		// Started before the breaker opened, the probe decides from here
+		return tr
+	}
+	b.window[b.next] = breakerSample{items: items, failed: failed}
+	b.next = (b.next + 1) % len(b.window)
+	b.filled = min(b.filled+1, len(b.window))
+	if b.filled < len(b.window) {
+		return tr
+	}
+	total, bad := 0, 0
+	for _, s := range b.window {
+		total += s.items
+		bad += s.failed
+	}
+	if float64(bad) >= b.ratio*float64(total) {
+		return b.open(now)
+	}
+	return tr
+}
+
+// open trips the breaker, must be called with mu held
+func (b *breaker) open(now time.Time) breakerTransition {
+	b.openUntil = now.Add(b.openTimeout)
+	return b.setState(BREAKER_OPEN)
+}
+
+// admit decides where the next batch goes. While the breaker is open the
+// batch goes to the fallback, or the worker holds it until a probe may run.
+// ok is false once the batcher stops.
+func (w *batchWorker[T]) admit() (fallback, probe, ok bool) {
+	c := w.c
+	if c.breaker == nil {
+		return false, false, true
+	}
+	for {
+		allowed, probe, wait, changed, tr := c.breaker.acquire(time.Now())
+		w.breakerChanged(tr)
+		if allowed {
+			return false, probe, true
+		}
+		if c.fallback != nil {
+			return true, false, true
+		}
+		// Holding the batch keeps this worker off the queue, which is the backpressure
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-c.ctx.Done():
+		case <-timeout:
+		case <-changed:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if c.ctx.Err() != nil {
+			return false, false, false
+		}
+	}
+}
+
+// breakerChanged reports a state change to the OnStateChange hook
+func (w *batchWorker[T]) breakerChanged(tr breakerTransition) {
+	if tr.from == tr.to || w.c.onBreakerChange == nil {
+		return
+	}
+	w.safely(func() { w.c.onBreakerChange(tr.from, tr.to) })
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"hash/fnv"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/panjf2000/ants/v2"
@@ -14,6 +16,7 @@ var (
 	ErrWorkerNotSet    = errors.New("worker pool size must be greater than zero")
 	ErrProcessorNotSet = errors.New("processor function must not be nil")
 	ErrInvalidTimeout  = errors.New("Timeout duration must be positive")
+	ErrBatcherStopped  = errors.New("batcher已停止")
 )
 
 // Batcher [T any] can add an item of type T, returning the corresponding error
@@ -21,8 +24,45 @@ type Batcher[T any] interface {
 	// Add adds an item to the current batch
 	Add(T) error
 
-	// Stop stops the BatcherInstance
+	// AddAsync adds an item to the current batch and returns a Future that
+	// resolves to the item's entry in the error slice returned by the Processor
+	AddAsync(T) *Future
+
+	// AddWithPriority adds an item to the lane BatchConfig.Lanes[priority].
+	// Without lanes only priority 0 is valid
+	AddWithPriority(item T, priority int) error
+
+	// TryAdd adds an item only if that is possible without blocking and
+	// reports whether it was enqueued
+	TryAdd(T) bool
+
+	// AddContext adds an item on behalf of the request carried by ctx. It
+	// returns ctx.Err() if ctx ends while the queue is still full, and the span
+	// found in ctx is linked from the span of the batch that processes it
+	AddContext(ctx context.Context, item T) error
+
+	// Stop stops the BatcherInstance, items that have not been processed yet are dropped
 	Stop()
+
+	// Shutdown stops accepting new items and processes everything already
+	// accepted before returning. If ctx ends first the remaining items are
+	// dropped and a *DrainError reporting how many were lost is returned.
+	Shutdown(ctx context.Context) error
+
+	// Flush makes every worker process its partial batch, together with the
+	// items that were already queued, and waits until those processor calls
+	// have returned. Items added before Flush are processed when it returns nil.
+	Flush(ctx context.Context) error
+
+	// Stats returns a snapshot of the batcher's runtime counters
+	Stats() Stats
+
+	// Reconfigure applies new batch sizes, timeouts, retry limits and pool
+	// size while the batcher runs, see ChanBatcherInstance.Reconfigure
+	Reconfigure(BatchConfig) error
+
+	// Config returns the configuration in effect, a starting point for Reconfigure
+	Config() BatchConfig
 }
 
 // Processor [T any] is a function that accepts items of type T and returns a corresponding array of errors
@@ -34,8 +74,12 @@ type SchedulingPolicy int
 const (
 	// ROUND_ROBIN distributes items evenly across workers
 	ROUND_ROBIN SchedulingPolicy = iota
-	// ORDERED_SEQUENTIAL processes items in strict order using a single worker
+	// ORDERED_SEQUENTIAL processes items in strict order using a single worker,
+	// failed items are retried before the worker moves on
 	ORDERED_SEQUENTIAL
+	// KEY_HASH routes items to workers by a hash of their partition key, items
+	// with the same key are processed in order while all workers run in parallel
+	KEY_HASH
 )
 
 type BatchConfig struct {
@@ -59,50 +103,193 @@ type BatchConfig struct {
 	MaxBatchSize int
 	// AdaptiveThreshold 批次大小调整的阈值
 	AdaptiveThreshold time.Duration
+	// TargetLatency 处理器单次调用的目标耗时，设置后批次大小和超时按AIMD自动调整
+	TargetLatency time.Duration
+	// TargetItemLatency 数据从添加到得出结果的目标耗时，设置后批次大小和超时按AIMD自动调整
+	TargetItemLatency time.Duration
+	// MaxAttempts 每条数据的最大处理次数（含首次），小于等于1表示失败不重试；
+	// ORDERED_SEQUENTIAL和KEY_HASH下worker等待退避并完成重试后才处理后续数据
+	MaxAttempts int
+	// RetryBackoffBase 重试退避的基础时长，每次重试翻倍，默认100ms
+	RetryBackoffBase time.Duration
+	// RetryBackoffMax 重试退避的上限，默认10s
+	RetryBackoffMax time.Duration
+	// IsRetryable 判断处理器返回的错误是否可重试，为nil时所有错误都重试
+	IsRetryable func(error) bool
+	// ProcessTimeout 每次处理器调用的超时，超时后取消传给ContextProcessor的ctx，worker不再等待并将数据标记为ErrProcessTimeout，0表示不限制；
+	// ORDERED_SEQUENTIAL和KEY_HASH下为保证顺序只取消ctx、继续等待处理器返回，每个worker同时最多放弃一次调用
+	ProcessTimeout time.Duration
+	// OnSlowBatch 处理器调用超过ProcessTimeout时在worker协程中调用，处理器可能仍在后台运行；
+	// ORDERED_SEQUENTIAL和KEY_HASH下在超时时调用，此时处理器尚未返回，Failed为0
+	OnSlowBatch func(info BatchInfo)
+	// OnPanic 处理器或回调panic时调用，worker会在恢复后继续运行
+	OnPanic func(workerID int, err *PanicError)
+	// Observer 每次处理器调用结束后接收批次信息，用于接入监控系统
+	Observer BatchObserver
+	// Tracer 为每次处理器调用创建span，并链接到每条数据的调用方span
+	Tracer BatchTracer
+	// OverflowPolicy 队列满时Add的行为，默认阻塞
+	OverflowPolicy OverflowPolicy
+	// MaxOpenKeys 仅用于NewKeyedBatcher，所有worker同时缓冲的key数量上限，超出时立即处理最早的key，0表示不限制
+	MaxOpenKeys int
+	// Durability 是否在Add返回前将数据写入磁盘预写日志，重启后重新投递未处理的数据
+	Durability Durability
+	// WALDir 预写日志目录，启用Durability时必填
+	WALDir string
+	// WALSegmentSize 单个日志段文件的大小上限，默认64MB
+	WALSegmentSize int64
+	// SpillDir 溢出文件目录，OverflowPolicy为OVERFLOW_SPILL_TO_DISK时必填
+	SpillDir string
+	// SpillMaxBytes 溢出文件占用的磁盘上限，超出后Add退化为阻塞，默认1GB
+	SpillMaxBytes int64
+	// MaxBatchWeight 每批数据的总权重上限（如字节数），需配合WithWeight使用，0表示不限制
+	MaxBatchWeight int
+	// OversizePolicy 单条数据权重超过MaxBatchWeight时的处理方式，默认单独成批
+	OversizePolicy OversizePolicy
+	// Lanes 优先级通道，下标即AddWithPriority的priority，Add使用通道0；为空时只有一个队列，不能与KEY_HASH和NewKeyedBatcher同时使用
+	Lanes []LaneConfig
+	// Breaker 处理器熔断配置，FailureRatio为0时不启用
+	Breaker BreakerConfig
+	// MaxWorkers 自动扩缩容的worker数量上限，大于0时启用自动扩缩容，PoolSize为初始数量
+	MaxWorkers int
+	// MinWorkers 自动扩缩容的worker数量下限，默认1
+	MinWorkers int
+	// ScaleInterval 自动扩缩容的采样间隔，默认1s
+	ScaleInterval time.Duration
+	// ScaleDownIdle worker持续空闲多久后被移除一个，默认30s
+	ScaleDownIdle time.Duration
+	// OnScale 自动扩缩容改变worker数量时调用
+	OnScale func(from, to int)
+}
+
+// entry wraps a queued item with the bookkeeping needed to report its outcome
+type entry[T any] struct {
+	item       T
+	future     *Future         // nil for items added via Add
+	ctx        context.Context // Caller context from AddContext, nil otherwise
+	key        any             // Result of the key function for keyed batchers
+	walSeq     uint64          // Sequence number in the write-ahead log, 0 when not logged
+	lane       int             // Priority lane the entry was added to
+	weight     int             // Result of the weight function, 0 without WithWeight
+	mergeKey   any             // Result of the coalescing key function
+	enqueuedAt time.Time       // When the item was accepted
+	merged     []entry[T]      // Entries coalesced into this one, settled together with it
+	attempt    int             // Number of failed processing attempts so far
+	retryAt    time.Time       // When a failed entry becomes eligible for its next attempt
 }
 
 // ChanBatcherInstance 阻塞式批处理器（有缓冲channel）
 type ChanBatcherInstance[T any] struct {
-	processor   Processor[T]
-	itemLimit   int
-	queue       chan T // 有缓冲channel
+	processor   ContextProcessor[T]
+	queues      []chan entry[T] // 每个worker读取的有缓冲channel，仅按key分区时各不相同
 	workerCount int
 	workers     *ants.Pool
 	ctx         context.Context
 	cancel      context.CancelFunc
-	timeout     time.Duration
-	baseTimeout time.Duration
 	jitterSeed  uint32
-	// Pre-computed jittered timeouts for each worker to avoid repeated hash calculations
-	jitteredTimeouts []time.Duration
-	mu          sync.RWMutex // Protects dynamic batching calculations
-	stopOnce    sync.Once    // 确保Stop()只执行一次
+	// Settings Reconfigure can change, loaded by the workers for every batch
+	limits   atomic.Pointer[limits]
+	config   BatchConfig  // As passed in, with the changes made by Reconfigure
+	mu       sync.RWMutex // Serializes Reconfigure, protects config
+	stopOnce sync.Once    // 确保Stop()只执行一次
+	// Intake and shutdown coordination
+	intakeMu  sync.RWMutex  // Held for reading while an item is being enqueued
+	closing   chan struct{} // Closed once no more items are accepted
+	closeOnce sync.Once
+	draining  chan struct{} // Closed to ask workers to drain the queue and exit
+	drainOnce sync.Once
+	workerWG  sync.WaitGroup // Tracks running worker loops
+	pending   atomic.Int64   // Items accepted but not yet processed or dropped
+	// Running workers sorted by id, including retiring ones
+	slotsMu sync.Mutex
+	slots   []*workerSlot
 	// Scheduling configuration
 	schedulingPolicy SchedulingPolicy
-	// Dynamic batching fields
-	dynamicBatching   bool
-	minBatchSize      int
-	maxBatchSize      int
-	adaptiveThreshold time.Duration
+	overflowPolicy   OverflowPolicy
+	// Retry policy, the limits are part of limits
+	isRetryable func(error) bool
+	// Receives permanently failed items, may be nil
+	deadLetter DeadLetterSink[T]
+	onPanic    func(workerID int, err *PanicError)
+	observer   BatchObserver
+	tracer     BatchTracer
+	// Keyed batching, keyFn is nil for plain batchers
+	keyFn       func(T) any
+	maxOpenKeys int
+	openKeys    atomic.Int64 // Keys buffered by all workers together
+	// KEY_HASH routing key, nil means route by keyFn
+	partitionKey func(T) any
+	// Write-ahead log, nil unless Durability is enabled
+	wal   *segmentLog
+	codec Codec[T]
+	// Overflow spill, one per lane, nil unless OVERFLOW_SPILL_TO_DISK is used
+	spills    []*spillQueue[T]
+	spillDone chan struct{} // Closed once the spill drain goroutines have exited
+	// Priority lanes, nil unless BatchConfig.Lanes is set
+	lanes *laneSet[T]
+	// Weight batching, weightFn is nil unless WithWeight is used
+	weightFn       func(T) int
+	maxBatchWeight int
+	oversizePolicy OversizePolicy
+	// Coalescing, coalesceKey is nil unless WithCoalescing is used
+	coalesceKey func(T) any
+	merge       func(old, new T) T
+	// Circuit breaker, nil unless BreakerConfig.FailureRatio is set
+	breaker         *breaker
+	fallback        ContextProcessor[T]
+	onBreakerChange func(from, to BreakerState)
+	// AIMD batch size and flush interval, nil unless a latency target is set
+	latency *latencyController
+	onScale func(from, to int)
+	// Called for batches that exceeded ProcessTimeout, may be nil
+	onSlowBatch func(info BatchInfo)
+	// Source of Batch.ID
+	batchSeq atomic.Uint64
+	// Runtime counters exposed through Stats()
+	stats batcherStats
 }
 
 // NewChanBatcher 创建阻塞式批处理器
 func NewChanBatcher[T any](
 	processor Processor[T],
 	batchConfig BatchConfig,
+	opts ...Option[T],
 ) (Batcher[T], error) {
+	instance, err := newChanBatcher(contextProcessor(processor), batchConfig, buildOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+func newChanBatcher[T any](
+	processor ContextProcessor[T],
+	batchConfig BatchConfig,
+	o options[T],
+) (*ChanBatcherInstance[T], error) {
 	var err error
 	if batchConfig.Ctx == nil {
 		batchConfig.Ctx = context.Background()
 	}
-	
+	if batchConfig.MaxWorkers > 0 {
+		if batchConfig.SchedulingPolicy != ROUND_ROBIN || o.keyFn != nil {
+			return nil, ErrAutoscaleUnsupported
+		}
+		lo, hi, err := workerRange(batchConfig)
+		if err != nil {
+			return nil, err
+		}
+		// Start with PoolSize workers, or the minimum when it is not set
+		batchConfig.PoolSize = min(max(batchConfig.PoolSize, lo), hi)
+	}
+
 	// Adjust worker count based on scheduling policy
 	actualWorkers := batchConfig.PoolSize
 	if batchConfig.SchedulingPolicy == ORDERED_SEQUENTIAL {
 		// For ordered processing, use only one worker to maintain order
 		actualWorkers = 1
 	}
-	
+
 	// 优化队列大小以提高内存效率
 	queueSize := batchConfig.QueueSize
 	if queueSize <= 0 {
@@ -129,6 +316,33 @@ func NewChanBatcher[T any](
 	if processor == nil {
 		return nil, ErrProcessorNotSet
 	}
+	if !batchConfig.OverflowPolicy.valid() {
+		return nil, ErrInvalidOverflowPolicy
+	}
+	if batchConfig.SchedulingPolicy == KEY_HASH && o.partitionKey == nil && o.keyFn == nil {
+		return nil, ErrPartitionKeyNotSet
+	}
+	if !batchConfig.Durability.valid() {
+		return nil, ErrInvalidDurability
+	}
+	if batchConfig.Durability != DURABILITY_NONE && batchConfig.WALDir == "" {
+		return nil, ErrWALDirNotSet
+	}
+	if batchConfig.OverflowPolicy == OVERFLOW_SPILL_TO_DISK && batchConfig.SpillDir == "" {
+		return nil, ErrSpillDirNotSet
+	}
+	if batchConfig.MaxBatchWeight > 0 && o.weightFn == nil {
+		return nil, ErrWeightFuncNotSet
+	}
+	if len(batchConfig.Lanes) > 0 && partitions(batchConfig.SchedulingPolicy, o.keyFn != nil) {
+		return nil, ErrLanesPartitioned
+	}
+	if !batchConfig.OversizePolicy.valid() {
+		return nil, ErrInvalidOversizePolicy
+	}
+	if batchConfig.Breaker.FailureRatio < 0 || batchConfig.Breaker.FailureRatio > 1 {
+		return nil, ErrInvalidFailureRatio
+	}
 
 	ctx, cancel := context.WithCancel(batchConfig.Ctx)
 
@@ -137,207 +351,318 @@ func NewChanBatcher[T any](
 	h.Write([]byte(time.Now().String()))
 	jitterSeed := h.Sum32()
 
-	// Set up dynamic batching parameters
-	minBatchSize := batchConfig.MinBatchSize
-	if minBatchSize <= 0 {
-		minBatchSize = batchConfig.BatchSize / 4
-		if minBatchSize < 1 {
-			minBatchSize = 1
-		}
+	instance := &ChanBatcherInstance[T]{
+		processor:        processor,
+		ctx:              ctx,
+		cancel:           cancel,
+		jitterSeed:       jitterSeed,
+		config:           batchConfig,
+		schedulingPolicy: batchConfig.SchedulingPolicy,
+		overflowPolicy:   batchConfig.OverflowPolicy,
+		isRetryable:      batchConfig.IsRetryable,
+		deadLetter:       o.deadLetter,
+		onPanic:          batchConfig.OnPanic,
+		observer:         batchConfig.Observer,
+		tracer:           batchConfig.Tracer,
+		keyFn:            o.keyFn,
+		maxOpenKeys:      max(batchConfig.MaxOpenKeys, 0),
+		partitionKey:     o.partitionKey,
+		weightFn:         o.weightFn,
+		maxBatchWeight:   max(batchConfig.MaxBatchWeight, 0),
+		oversizePolicy:   batchConfig.OversizePolicy,
+		coalesceKey:      o.coalesceKey,
+		merge:            o.merge,
+		fallback:         contextProcessor(o.fallback),
+		onBreakerChange:  batchConfig.Breaker.OnStateChange,
+		onScale:          batchConfig.OnScale,
+		onSlowBatch:      batchConfig.OnSlowBatch,
+		closing:          make(chan struct{}),
+		draining:         make(chan struct{}),
 	}
 
-	maxBatchSize := batchConfig.MaxBatchSize
-	if maxBatchSize <= 0 {
-		maxBatchSize = batchConfig.BatchSize * 4
+	instance.config.Lanes = slices.Clone(batchConfig.Lanes)
+	l := newLimits(batchConfig)
+	instance.limits.Store(l)
+	if batchConfig.Breaker.FailureRatio > 0 {
+		instance.breaker = newBreaker(batchConfig.Breaker)
+	}
+	if batchConfig.TargetLatency > 0 || batchConfig.TargetItemLatency > 0 {
+		instance.latency = newLatencyController(max(batchConfig.TargetLatency, 0), max(batchConfig.TargetItemLatency, 0),
+			l.batchSize, l.minBatchSize, l.maxBatchSize)
 	}
 
-	adaptiveThreshold := batchConfig.AdaptiveThreshold
-	if adaptiveThreshold <= 0 {
-		adaptiveThreshold = batchConfig.Timeout / 2
+	instance.codec = o.codec
+	if instance.codec == nil {
+		instance.codec = JSONCodec[T]{}
+	}
+	if batchConfig.OverflowPolicy == OVERFLOW_SPILL_TO_DISK {
+		instance.spills, err = newSpillQueues(batchConfig.SpillDir, batchConfig.SpillMaxBytes, max(len(batchConfig.Lanes), 1), instance.codec)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
 	}
 
-	instance := &ChanBatcherInstance[T]{
-		processor:         processor,
-		itemLimit:         batchConfig.BatchSize,
-		queue:             make(chan T, queueSize),
-		ctx:               ctx,
-		cancel:            cancel,
-		timeout:           batchConfig.Timeout,
-		baseTimeout:       batchConfig.Timeout,
-		jitterSeed:        jitterSeed,
-		schedulingPolicy:  batchConfig.SchedulingPolicy,
-		dynamicBatching:   batchConfig.DynamicBatching,
-		minBatchSize:      minBatchSize,
-		maxBatchSize:      maxBatchSize,
-		adaptiveThreshold: adaptiveThreshold,
-	}
-
-	// Pre-compute jittered timeouts for all workers to avoid repeated hash calculations
-	instance.jitteredTimeouts = make([]time.Duration, actualWorkers)
-	for i := 0; i < actualWorkers; i++ {
-		instance.jitteredTimeouts[i] = instance.generateJitteredTimeout(i)
+	// 打开预写日志，读出上次运行未处理完的数据
+	var replay []entry[T]
+	if batchConfig.Durability != DURABILITY_NONE {
+		instance.wal, replay, err = openWAL(batchConfig, instance.codec)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
 	}
 
 	// 创建工作池
 	pool, err := ants.NewPool(actualWorkers)
 	if err != nil {
+		instance.closeWAL()
+		cancel()
 		return nil, err
 	}
 	instance.workers = pool
-	instance.workerCount = actualWorkers
+	instance.queues = make([]chan entry[T], actualWorkers)
+	if len(batchConfig.Lanes) > 0 {
+		// Items wait in their lane, the worker queues only hand them over so
+		// that the dispatcher decides as late as possible what comes next
+		instance.lanes = newLaneSet[T](batchConfig.Lanes, queueSize)
+		queueSize = 0
+	}
+	if instance.partitioned() {
+		// Every worker owns a partition, QueueSize is split between them
+		partitionSize := (queueSize + actualWorkers - 1) / actualWorkers
+		for i := range instance.queues {
+			instance.queues[i] = make(chan entry[T], partitionSize)
+		}
+	} else {
+		queue := make(chan entry[T], queueSize)
+		for i := range instance.queues {
+			instance.queues[i] = queue
+		}
+	}
 	// 启动worker with error handling
-	for i := 0; i < actualWorkers; i++ {
-		workerID := i
-		err := pool.Submit(func() { 
-			// Add recovery mechanism for worker panics
-			defer func() {
-				if r := recover(); r != nil {
-					// Log the panic but don't crash the entire system
-					// In production, you might want to use a proper logger
-				}
-			}()
-			instance.worker(workerID) 
-		})
-		if err != nil {
-			// If worker startup fails, clean up resources
-			cancel()
-			pool.Release()
-			return nil, err
+	if err := instance.resize(actualWorkers); err != nil {
+		// If worker startup fails, clean up resources
+		cancel()
+		pool.Release()
+		instance.closeWAL()
+		return nil, err
+	}
+	if batchConfig.MaxWorkers > 0 {
+		go instance.autoscale()
+	}
+	if instance.lanes != nil {
+		go func() {
+			defer close(instance.lanes.done)
+			instance.dispatchLanes()
+		}()
+	}
+	if instance.spills != nil {
+		instance.spillDone = make(chan struct{})
+		var drains sync.WaitGroup
+		for _, s := range instance.spills {
+			drains.Add(1)
+			go func(s *spillQueue[T]) {
+				defer drains.Done()
+				instance.drainSpill(s)
+			}(s)
 		}
+		go func() {
+			drains.Wait()
+			close(instance.spillDone)
+		}()
 	}
+	instance.replay(replay)
 
 	return instance, nil
 }
 
-// Add 方法（完全阻塞式）
+// Add 方法（队列满时默认阻塞，行为由OverflowPolicy决定）
 func (c *ChanBatcherInstance[T]) Add(item T) error {
-	// 首先检查context是否已取消
+	return c.enqueue(entry[T]{item: item})
+}
+
+// AddAsync 与Add相同，但返回可等待处理结果的Future
+func (c *ChanBatcherInstance[T]) AddAsync(item T) *Future {
+	f := newFuture()
+	if err := c.enqueue(entry[T]{item: item, future: f}); err != nil {
+		f.resolve(err)
+	}
+	return f
+}
+
+// AddContext 与Add相同，但队列满时最多阻塞到ctx结束，并记录调用方context用于链路追踪
+func (c *ChanBatcherInstance[T]) AddContext(ctx context.Context, item T) error {
+	return c.enqueue(entry[T]{item: item, ctx: ctx})
+}
+
+// enqueue adds e to the queue, applying the overflow policy when it is full
+func (c *ChanBatcherInstance[T]) enqueue(e entry[T]) error {
+	return c.offer(e, true)
+}
+
+// offer accepts e into the queue. With wait set a full queue blocks until
+// space frees up, the batcher stops or the caller's context (e.ctx) ends,
+// unless the overflow policy says otherwise.
+func (c *ChanBatcherInstance[T]) offer(e entry[T], wait bool) error {
+	if c.keyFn != nil {
+		e.key = c.keyFn(e.item)
+	}
+	if c.coalesceKey != nil {
+		e.mergeKey = c.coalesceKey(e.item)
+	}
+	if err := c.weigh(&e); err != nil {
+		return err
+	}
+	e.enqueuedAt = time.Now()
+	q := c.queueFor(&e)
+	// 调用方已放弃时不再入队
+	var callerDone <-chan struct{}
+	if e.ctx != nil {
+		if err := e.ctx.Err(); err != nil {
+			return err
+		}
+		callerDone = e.ctx.Done()
+	}
+
+	// 持有读锁期间关闭流程无法完成，保证关闭后不会再有数据进入队列
+	c.intakeMu.RLock()
+	defer c.intakeMu.RUnlock()
+
+	// 首先检查是否已停止接收
 	select {
+	case <-c.closing:
+		return ErrBatcherStopped
 	case <-c.ctx.Done():
-		return errors.New("batcher已停止")
+		return ErrBatcherStopped
 	default:
 	}
-	
-	// 使用defer recover来捕获向已关闭channel发送数据的panic
-	defer func() {
-		if r := recover(); r != nil {
-			// channel已关闭，但我们已经在上面检查了context
-			// 这种情况不应该发生，但为了安全起见保留recover
-		}
-	}()
-	
+
+	// 启用Durability时先写入预写日志
+	if err := c.logEntry(&e); err != nil {
+		return err
+	}
+
+	// Count before sending so a fast worker never observes more items
+	// processed than accepted
+	c.pending.Add(1)
+	c.stats.added.Add(1)
+	if c.spills != nil && c.spills[e.lane].backlog() > 0 {
+		// Spilled items of the lane go first, new items queue up behind them on disk
+		return c.overflow(q, e, wait, callerDone)
+	}
 	select {
-	case <-c.ctx.Done():
-		return errors.New("batcher已停止")
-	case c.queue <- item: // 关键点：channel满时会自动阻塞
+	case q <- e:
 		return nil
+	default:
+		return c.overflow(q, e, wait, callerDone)
 	}
 }
 
+// unaccept reverts the accounting of an item that did not make it into the queue
+func (c *ChanBatcherInstance[T]) unaccept(e *entry[T]) {
+	c.pending.Add(-1)
+	c.stats.added.Add(^uint64(0))
+	c.ackEntries([]entry[T]{*e})
+}
+
 // generateJitteredTimeout creates a consistent jittered timeout for each worker
 // This prevents thundering herd effect by spreading timeout events across time
-func (c *ChanBatcherInstance[T]) generateJitteredTimeout(workerID int) time.Duration {
+func (c *ChanBatcherInstance[T]) generateJitteredTimeout(workerID int, baseTimeout time.Duration) time.Duration {
 	// Use consistent hash-based jitter to avoid synchronized timeouts
 	h := fnv.New32a()
 	h.Write([]byte{byte(c.jitterSeed), byte(c.jitterSeed >> 8), byte(c.jitterSeed >> 16), byte(c.jitterSeed >> 24)})
 	h.Write([]byte{byte(workerID)})
 	jitter := h.Sum32()
-	
+
 	// Apply jitter: ±20% of base timeout
-	jitterRange := int64(c.baseTimeout) / 5 // 20% of base timeout
-	jitterOffset := int64(jitter) % (jitterRange * 2) - jitterRange
-	
-	return c.baseTimeout + time.Duration(jitterOffset)
+	jitterRange := int64(baseTimeout) / 5 // 20% of base timeout
+	jitterOffset := int64(jitter)%(jitterRange*2) - jitterRange
+
+	return baseTimeout + time.Duration(jitterOffset)
 }
 
 // calculateDynamicBatchSize adjusts batch size based on queue pressure and processing time
 func (c *ChanBatcherInstance[T]) calculateDynamicBatchSize() int {
-	if !c.dynamicBatching {
-		return c.itemLimit
+	if c.latency != nil {
+		// Latency targets take over from queue pressure
+		return c.latency.batchSize()
+	}
+	l := c.limits.Load()
+	if !l.dynamicBatching {
+		return l.batchSize
 	}
 
 	// Calculate queue pressure (0.0 to 1.0)
-	queueLen := len(c.queue)
-	queueCap := cap(c.queue)
+	queueLen, queueCap := c.queueDepth()
 	queuePressure := float64(queueLen) / float64(queueCap)
 
 	// Adjust batch size based on queue pressure
 	var targetBatchSize int
 	if queuePressure > 0.8 {
 		// High pressure: increase batch size for better throughput
-		targetBatchSize = c.maxBatchSize
+		targetBatchSize = l.maxBatchSize
 	} else if queuePressure < 0.2 {
 		// Low pressure: decrease batch size for better latency
-		targetBatchSize = c.minBatchSize
+		targetBatchSize = l.minBatchSize
 	} else {
 		// Medium pressure: interpolate between min and max
-		range_ := c.maxBatchSize - c.minBatchSize
-		targetBatchSize = c.minBatchSize + int(float64(range_)*queuePressure)
+		range_ := l.maxBatchSize - l.minBatchSize
+		targetBatchSize = l.minBatchSize + int(float64(range_)*queuePressure)
 	}
 
 	return targetBatchSize
 }
 
-func (c *ChanBatcherInstance[T]) worker(workerID int) {
-	// Each worker gets a pre-computed jittered timeout to prevent thundering herd
-	jitteredTimeout := c.jitteredTimeouts[workerID]
-	timer := time.NewTimer(jitteredTimeout)
-	defer timer.Stop()
-	
-	// Start with initial capacity, will grow as needed
-	buffer := make([]T, 0, c.itemLimit)
-	lastBatchTime := time.Now()
-
-	for {
-		// Calculate current target batch size
-		currentBatchSize := c.calculateDynamicBatchSize()
-		
-		select {
-		case <-c.ctx.Done():
-			// Don't process remaining buffer on shutdown to avoid duplicate processing
-			// The Stop() method ensures proper shutdown sequence
-			return
-		case item := <-c.queue:
-			buffer = append(buffer, item)
-			
-			// Check if we should process based on current batch size or adaptive threshold
-			shouldProcess := len(buffer) >= currentBatchSize
-			if c.dynamicBatching && !shouldProcess {
-				// Also check if we've been accumulating for too long
-				elapsedSinceLastBatch := time.Since(lastBatchTime)
-				shouldProcess = elapsedSinceLastBatch >= c.adaptiveThreshold
-			}
-			
-			if shouldProcess {
-				c.processor(buffer)
-				buffer = buffer[:0]
-				lastBatchTime = time.Now()
-				// Reset with pre-computed jittered timeout
-				timer.Reset(jitteredTimeout)
-			}
-		case <-timer.C:
-			if len(buffer) > 0 {
-				c.processor(buffer)
-				buffer = buffer[:0]
-				lastBatchTime = time.Now()
-			}
-			// Reset with pre-computed jittered timeout
-			timer.Reset(jitteredTimeout)
+// fail resolves the futures of entries that will never be processed
+func (c *ChanBatcherInstance[T]) fail(entries []entry[T], err error) {
+	for i := range entries {
+		if entries[i].merged != nil {
+			c.fail(entries[i].merged, err)
+		}
+		if entries[i].future != nil {
+			entries[i].future.resolve(err)
 		}
 	}
+	c.pending.Add(-int64(len(entries)))
+	c.stats.dropped.Add(uint64(len(entries)))
+	clear(entries)
 }
 
 // Stop 停止批处理器
 func (c *ChanBatcherInstance[T]) Stop() {
 	c.stopOnce.Do(func() {
-		// Step 1: Cancel the context to signal workers to stop
+		// Step 1: Stop accepting new items
+		c.closeIntake()
+
+		// Step 2: Cancel the context to signal workers to stop
 		c.cancel()
-		
-		// Step 2: Close the queue to prevent new items from being added
-		close(c.queue)
-		
-		// Step 3: Wait for all workers to finish processing remaining items
-		// The ants pool will wait for all submitted tasks to complete
+
+		// Step 3: Release the pool, workers exit once their current batch returns
 		c.workers.Release()
+		// The spill and lane goroutines must not refill the queues after step 4
+		if c.spillDone != nil {
+			<-c.spillDone
+		}
+		if c.lanes != nil {
+			<-c.lanes.done
+		}
+
+		// Step 4: Items still queued will never be processed, tell their owners
+		for _, q := range c.distinctQueues() {
+			for drained := false; !drained; {
+				select {
+				case e := <-q:
+					c.fail([]entry[T]{e}, ErrBatcherStopped)
+				default:
+					drained = true
+				}
+			}
+		}
+
+		c.closeSpill()
+
+		// Step 5: Unprocessed items stay in the write-ahead log for the next run
+		c.closeWAL()
 	})
 }
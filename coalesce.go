@@ -0,0 +1,84 @@
+package batchy
+
+// WithCoalescing merges items with equal keys while they wait in the same
+// worker buffer, so the processor sees one item per key and batch. merge
+// receives the buffered item and the newly added one and returns the item to
+// keep; a nil merge keeps the newest item. The merged item keeps the buffer
+// position of the first one. Every caller still gets its own result: futures
+// and write-ahead log records of all merged items settle with the merged item.
+// Items that are waiting for a retry are never merged.
+func WithCoalescing[T any, K comparable](keyFn func(T) K, merge func(old, new T) T) Option[T] {
+	return func(o *options[T]) {
+		if keyFn == nil {
+			return
+		}
+		o.coalesceKey = func(item T) any {
+			return keyFn(item)
+		}
+		o.merge = merge
+	}
+}
+
+// coalesce merges e into the entry with the same key in entries, whose
+// positions are tracked by index. It reports whether e was merged and by how
+// much the weight of entries changed.
+func (w *batchWorker[T]) coalesce(index map[any]int, entries []entry[T], e *entry[T]) (merged bool, delta int) {
+	if index == nil || e.attempt > 0 {
+		return false, 0
+	}
+	i, ok := index[e.mergeKey]
+	if !ok {
+		index[e.mergeKey] = len(entries)
+		return false, 0
+	}
+	old := &entries[i]
+	item, ok := w.mergeItems(old.item, e.item)
+	if !ok {
+		// A panicking merge keeps both items, the new one is indexed from now on
+		index[e.mergeKey] = len(entries)
+		return false, 0
+	}
+	old.item = item
+	if c := w.c; c.weightFn != nil {
+		weight := old.weight
+		// The merged item is never rejected, an oversized one is emitted alone
+		_ = c.weigh(old)
+		delta = old.weight - weight
+	}
+	// Only the bookkeeping of e is kept, its item is part of old now
+	var zero T
+	e.item = zero
+	old.merged = append(old.merged, *e)
+	w.c.stats.coalesced.Add(1)
+	return true, delta
+}
+
+// mergeItems applies the merge function, a panic is reported and ok is false
+func (w *batchWorker[T]) mergeItems(old, new T) (item T, ok bool) {
+	if w.c.merge == nil {
+		return new, true
+	}
+	w.safely(func() {
+		item = w.c.merge(old, new)
+		ok = true
+	})
+	return item, ok
+}
+
+// settles returns how many added items settle together with e
+func (e *entry[T]) settles() int {
+	return 1 + len(e.merged)
+}
+
+// walSeqs appends the log sequence numbers of e and its merged entries to seqs
+func (e *entry[T]) walSeqs(seqs []uint64) []uint64 {
+	if e.walSeq != 0 {
+		seqs = append(seqs, e.walSeq)
+	}
+	for i := range e.merged {
+		if e.merged[i].walSeq != 0 {
+			seqs = append(seqs, e.merged[i].walSeq)
+		}
+	}
+	return seqs
+}
@@ -0,0 +1,62 @@
+package batchy
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrProcessorPanic is matched by errors.Is for every item of a batch whose
+// processor call panicked
+var ErrProcessorPanic = errors.New("processor panicked")
+
+// PanicError is reported for each item of a batch whose processor panicked,
+// and passed to BatchConfig.OnPanic for any recovered panic
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace of the panicking goroutine
+	Stack []byte
+}
+
+// newPanicError must be called from the deferred function that recovered r
+func newPanicError(r any) *PanicError {
+	return &PanicError{Value: r, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("batchy: processor panicked: %v", e.Value)
+}
+
+// Is makes errors.Is(err, ErrProcessorPanic) report true
+func (e *PanicError) Is(target error) bool {
+	return target == ErrProcessorPanic
+}
+
+// DeadLetterSink receives items that failed permanently: the processor
+// reported a non-retryable error, the retry budget was exhausted, or the
+// processor panicked while handling their batch. items and errs have the same
+// length and are owned by the sink.
+type DeadLetterSink[T any] interface {
+	DeadLetter(items []T, errs []error)
+}
+
+// DeadLetterFunc adapts an ordinary function to a DeadLetterSink
+type DeadLetterFunc[T any] func(items []T, errs []error)
+
+// DeadLetter calls f(items, errs)
+func (f DeadLetterFunc[T]) DeadLetter(items []T, errs []error) {
+	f(items, errs)
+}
+
+// WithDeadLetter routes permanently failed items to sink
+func WithDeadLetter[T any](sink DeadLetterSink[T]) Option[T] {
+	return func(o *options[T]) {
+		o.deadLetter = sink
+	}
+}
+
+// WithDeadLetterFunc routes permanently failed items to fn
+func WithDeadLetterFunc[T any](fn func(items []T, errs []error)) Option[T] {
+	return WithDeadLetter[T](DeadLetterFunc[T](fn))
+}
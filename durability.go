@@ -0,0 +1,149 @@
+package batchy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrWALDirNotSet is returned when Durability is enabled without WALDir
+	ErrWALDirNotSet = errors.New("WALDir must be set when Durability is enabled")
+	// ErrInvalidDurability is returned for an unknown Durability mode
+	ErrInvalidDurability = errors.New("invalid durability mode")
+)
+
+// Durability defines whether accepted items are written to a write-ahead log
+type Durability int
+
+const (
+	// DURABILITY_NONE keeps items in memory only (default)
+	DURABILITY_NONE Durability = iota
+	// DURABILITY_BUFFERED writes every item to the log before Add returns,
+	// items survive a crash of the process but not of the machine
+	DURABILITY_BUFFERED
+	// DURABILITY_SYNC also fsyncs the log before Add returns
+	DURABILITY_SYNC
+)
+
+func (d Durability) valid() bool {
+	return d >= DURABILITY_NONE && d <= DURABILITY_SYNC
+}
+
+// defaultWALSegmentSize is used when WALSegmentSize is not set
+const defaultWALSegmentSize = 64 << 20
+
+// Codec serializes items for the write-ahead log
+type Codec[T any] interface {
+	Encode(item T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes items with encoding/json, it is the default Codec
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(item T) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var item T
+	err := json.Unmarshal(data, &item)
+	return item, err
+}
+
+// WithCodec sets the Codec used to write items to disk
+func WithCodec[T any](codec Codec[T]) Option[T] {
+	return func(o *options[T]) {
+		o.codec = codec
+	}
+}
+
+// openWAL opens the write-ahead log configured in batchConfig and decodes the
+// items a previous run left unprocessed
+func openWAL[T any](batchConfig BatchConfig, codec Codec[T]) (*segmentLog, []entry[T], error) {
+	segmentSize := batchConfig.WALSegmentSize
+	if segmentSize <= 0 {
+		segmentSize = defaultWALSegmentSize
+	}
+	wal, records, err := openSegmentLog(batchConfig.WALDir, batchConfig.Durability == DURABILITY_SYNC, segmentSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("batchy: open wal: %w", err)
+	}
+	replay := make([]entry[T], 0, len(records))
+	for _, rec := range records {
+		item, err := codec.Decode(rec.payload)
+		if err != nil {
+			_ = wal.close()
+			return nil, nil, fmt.Errorf("batchy: decode wal item %d: %w", rec.seq, err)
+		}
+		replay = append(replay, entry[T]{item: item, walSeq: rec.seq})
+	}
+	return wal, replay, nil
+}
+
+// logEntry appends e to the write-ahead log, an entry that already has a
+// sequence number is being replayed and is not logged again
+func (c *ChanBatcherInstance[T]) logEntry(e *entry[T]) error {
+	if c.wal == nil || e.walSeq != 0 {
+		return nil
+	}
+	data, err := c.codec.Encode(e.item)
+	if err != nil {
+		return fmt.Errorf("batchy: encode item: %w", err)
+	}
+	seq, err := c.wal.append(data)
+	if err != nil {
+		return fmt.Errorf("batchy: wal append: %w", err)
+	}
+	e.walSeq = seq
+	return nil
+}
+
+// ackEntries removes entries from the write-ahead log once they have a final
+// outcome. A failed ack is not reported: it only means a redelivery after
+// the next restart.
+func (c *ChanBatcherInstance[T]) ackEntries(entries []entry[T]) {
+	if c.wal == nil {
+		return
+	}
+	var seqs []uint64
+	for i := range entries {
+		seqs = entries[i].walSeqs(seqs)
+	}
+	_ = c.wal.ack(seqs)
+}
+
+// closeWAL closes the write-ahead log, if any
+func (c *ChanBatcherInstance[T]) closeWAL() {
+	if c.wal != nil {
+		_ = c.wal.close()
+	}
+}
+
+// replay queues the items recovered from the write-ahead log, blocking while
+// the queue is full. Called before the batcher is handed out.
+func (c *ChanBatcherInstance[T]) replay(entries []entry[T]) {
+	for _, e := range entries {
+		if c.keyFn != nil {
+			e.key = c.keyFn(e.item)
+		}
+		if c.coalesceKey != nil {
+			e.mergeKey = c.coalesceKey(e.item)
+		}
+		// Items logged before an oversize policy change are still replayed
+		_ = c.weigh(&e)
+		e.enqueuedAt = time.Now()
+		c.pending.Add(1)
+		c.stats.added.Add(1)
+		select {
+		case c.queueFor(&e) <- e:
+		case <-c.ctx.Done():
+			// Left in the log for the next run
+			c.pending.Add(-1)
+			c.stats.added.Add(^uint64(0))
+			return
+		}
+	}
+}
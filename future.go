@@ -0,0 +1,52 @@
+package batchy
+
+import (
+	"context"
+	"sync"
+)
+
+// Future is a handle to the outcome of a single item submitted via AddAsync.
+// It resolves to the item's entry in the error slice returned by the Processor,
+// or to the error that prevented the item from being processed at all.
+type Future struct {
+	done chan struct{}
+	once sync.Once
+	err  error
+	then func() // Runs once the future is resolved, may be nil
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// resolve completes the future; only the first call has any effect
+func (f *Future) resolve(err error) {
+	f.once.Do(func() {
+		f.err = err
+		close(f.done)
+		if f.then != nil {
+			f.then()
+		}
+	})
+}
+
+// Done returns a channel that is closed once the item's outcome is known
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the item has been processed and returns its error
+func (f *Future) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// WaitContext is like Wait but gives up when ctx is done, returning ctx.Err()
+func (f *Future) WaitContext(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,230 @@
+package batchy
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrKeyFuncNotSet is returned by NewKeyedBatcher when no key function is given
+var ErrKeyFuncNotSet = errors.New("key function must not be nil")
+
+// NewKeyedBatcher 创建按key分组的批处理器，每个批次只包含同一个key的数据。
+//
+// Items are routed to workers by key, as under KEY_HASH, so every key is
+// buffered by a single worker and BatchSize, Timeout and the adaptive
+// threshold apply to each key separately: a key's batch is emitted when it is
+// full or when Timeout has passed since its first item arrived. Because
+// PoolSize decides the routing it cannot be changed by Reconfigure, and
+// autoscaling is not supported.
+//
+// BatchConfig.MaxOpenKeys caps how many keys all workers buffer together. A
+// worker that opens one more key emits its own oldest key first; if all open
+// keys belong to other workers the item is emitted on its own.
+func NewKeyedBatcher[K comparable, T any](
+	keyFn func(T) K,
+	processor Processor[T],
+	batchConfig BatchConfig,
+	opts ...Option[T],
+) (Batcher[T], error) {
+	if keyFn == nil {
+		return nil, ErrKeyFuncNotSet
+	}
+	o := buildOptions(opts)
+	o.keyFn = func(item T) any {
+		return keyFn(item)
+	}
+	instance, err := newChanBatcher(contextProcessor(processor), batchConfig, o)
+	if err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+// keyGroup is the buffer of one key inside a worker
+type keyGroup[T any] struct {
+	entries []entry[T]
+	weight  int         // Total weight of entries when WithWeight is used
+	index   map[any]int // Position of each coalescing key in entries
+	seq     uint64      // Tells this group apart from earlier groups of the same key
+	opened  time.Time   // Arrival of the first entry, the key's timeout counts from here
+}
+
+// openedKey records the order in which a worker opened its key groups. Once a
+// group is emitted its record goes stale and is skipped lazily.
+type openedKey struct {
+	key any
+	seq uint64
+}
+
+// addKeyed buffers e under its key and emits that key's batch once it is full
+func (w *batchWorker[T]) addKeyed(e entry[T], batchSize int) {
+	c := w.c
+	g := w.groups[e.key]
+	if g != nil && c.overweight(len(g.entries), g.weight, e.weight) {
+		// e does not fit, emit the key's batch and start a new one
+		w.flushKey(e.key, batchSize, TRIGGER_WEIGHT)
+		g = nil
+	}
+	if g == nil {
+		if !w.reserveKey(batchSize) {
+			// No key can be opened, e cannot wait for more items of its key
+			retrying := len(w.retries)
+			w.emit([]entry[T]{e}, batchSize, TRIGGER_KEY_LIMIT)
+			if len(w.retries) != retrying {
+				w.armRetryTimer()
+			}
+			return
+		}
+		w.keySeq++
+		g = &keyGroup[T]{seq: w.keySeq, opened: time.Now()}
+		if c.coalesceKey != nil {
+			g.index = make(map[any]int)
+		}
+		w.groups[e.key] = g
+		w.opened = append(w.opened, openedKey{key: e.key, seq: g.seq})
+		w.compactOpened()
+	}
+	if merged, delta := w.coalesce(g.index, g.entries, &e); merged {
+		g.weight += delta
+	} else {
+		g.entries = append(g.entries, e)
+		g.weight += e.weight
+	}
+
+	shouldProcess := len(g.entries) >= batchSize
+	trigger := TRIGGER_SIZE
+	if !shouldProcess && c.maxBatchWeight > 0 && g.weight >= c.maxBatchWeight {
+		shouldProcess = true
+		trigger = TRIGGER_WEIGHT
+	}
+	if l := c.limits.Load(); l.dynamicBatching && !shouldProcess {
+		shouldProcess = time.Since(g.opened) >= l.adaptiveThreshold
+		trigger = TRIGGER_ADAPTIVE
+	}
+	if shouldProcess {
+		w.flushKey(e.key, batchSize, trigger)
+	}
+}
+
+// reserveKey counts a key this worker is about to open against MaxOpenKeys,
+// which is shared by all workers. While the limit is reached the worker emits
+// its own oldest keys; it reports false if all open keys belong to others.
+func (w *batchWorker[T]) reserveKey(batchSize int) bool {
+	c := w.c
+	for {
+		open := c.openKeys.Load()
+		if c.maxOpenKeys == 0 || open < int64(c.maxOpenKeys) {
+			if c.openKeys.CompareAndSwap(open, open+1) {
+				return true
+			}
+			continue
+		}
+		oldest, g := w.oldestKey()
+		if g == nil {
+			return false
+		}
+		w.flushKey(oldest, batchSize, TRIGGER_KEY_LIMIT)
+	}
+}
+
+// flushKey processes the buffer of one key in batches of at most batchSize
+func (w *batchWorker[T]) flushKey(key any, batchSize int, trigger FlushTrigger) {
+	g := w.groups[key]
+	if g == nil {
+		return
+	}
+	delete(w.groups, key)
+	w.c.openKeys.Add(-1)
+	retrying := len(w.retries)
+	w.emit(g.entries, batchSize, trigger)
+	w.lastBatchTime = time.Now()
+	if len(w.retries) != retrying {
+		w.armRetryTimer()
+	}
+}
+
+// flushKeys processes the buffers of all keys, oldest key first
+func (w *batchWorker[T]) flushKeys(batchSize int, trigger FlushTrigger) {
+	for _, rec := range w.opened {
+		if g := w.groups[rec.key]; g != nil && g.seq == rec.seq {
+			delete(w.groups, rec.key)
+			w.c.openKeys.Add(-1)
+			w.emit(g.entries, batchSize, trigger)
+		}
+	}
+	clear(w.opened)
+	w.opened = w.opened[:0]
+}
+
+// expireKeys emits every key whose timeout has passed
+func (w *batchWorker[T]) expireKeys(now time.Time, batchSize int) {
+	for {
+		key, g := w.oldestKey()
+		if g == nil || now.Sub(g.opened) < w.interval() {
+			return
+		}
+		w.flushKey(key, batchSize, TRIGGER_TIMEOUT)
+	}
+}
+
+// oldestKey returns the key that has been open the longest, dropping stale
+// records on the way. g is nil when no key is open.
+func (w *batchWorker[T]) oldestKey() (key any, g *keyGroup[T]) {
+	for len(w.opened) > 0 {
+		rec := w.opened[0]
+		if g := w.groups[rec.key]; g != nil && g.seq == rec.seq {
+			return rec.key, g
+		}
+		w.opened[0] = openedKey{}
+		w.opened = w.opened[1:]
+	}
+	return nil, nil
+}
+
+// compactOpened drops stale records once they outnumber the open keys, so a
+// long lived key cannot make the record list grow without bound
+func (w *batchWorker[T]) compactOpened() {
+	if len(w.opened) < 64 || len(w.opened) < 2*len(w.groups) {
+		return
+	}
+	live := w.opened[:0]
+	for _, rec := range w.opened {
+		if g := w.groups[rec.key]; g != nil && g.seq == rec.seq {
+			live = append(live, rec)
+		}
+	}
+	clear(w.opened[len(live):])
+	w.opened = live
+}
+
+// armKeyTimer points the worker's timer at the deadline of the oldest key
+func (w *batchWorker[T]) armKeyTimer() {
+	var deadline time.Time
+	if _, g := w.oldestKey(); g != nil {
+		deadline = g.opened.Add(w.interval())
+	}
+	if deadline.Equal(w.keyDeadline) {
+		return
+	}
+	if !w.timer.Stop() {
+		select {
+		case <-w.timer.C:
+		default:
+		}
+	}
+	w.keyDeadline = deadline
+	if !deadline.IsZero() {
+		w.timer.Reset(time.Until(deadline))
+	}
+}
+
+// abandonKeys drops the buffers of all keys
+func (w *batchWorker[T]) abandonKeys() {
+	for key, g := range w.groups {
+		w.c.fail(g.entries, ErrBatcherStopped)
+		delete(w.groups, key)
+		w.c.openKeys.Add(-1)
+	}
+	clear(w.opened)
+	w.opened = w.opened[:0]
+}
@@ -0,0 +1,187 @@
+package batchy
+
+import (
+	"errors"
+	"reflect"
+)
+
+var (
+	// ErrInvalidPriority is returned when a priority does not name a configured lane
+	ErrInvalidPriority = errors.New("batchy: priority does not match a lane")
+	// ErrLanesPartitioned is returned when Lanes are combined with KEY_HASH or
+	// a keyed batcher. The single dispatcher would wait for the busiest
+	// partition, and priorities would reorder the items of a key.
+	ErrLanesPartitioned = errors.New("Lanes cannot be combined with KEY_HASH or NewKeyedBatcher")
+)
+
+// LaneConfig configures one priority lane, see BatchConfig.Lanes
+type LaneConfig struct {
+	// Weight 调度权重，通道都有数据时按权重比例被选中，默认1
+	Weight int
+	// QueueSize 本通道的队列容量，默认与BatchConfig.QueueSize相同
+	QueueSize int
+}
+
+// laneSet holds the per-priority queues. A single dispatcher goroutine moves
+// items from the lanes to the workers, choosing between non-empty lanes with
+// smooth weighted round-robin, so a busy lane cannot starve the others.
+type laneSet[T any] struct {
+	queues  []chan entry[T]
+	weights []int
+	current []int // Smooth weighted round-robin state
+	// Flush requests, the dispatcher closes the reply once everything queued
+	// in the lanes at that moment has been handed to a worker
+	flushReqs chan chan struct{}
+	done      chan struct{} // Closed once the dispatcher has exited
+}
+
+func newLaneSet[T any](lanes []LaneConfig, queueSize int) *laneSet[T] {
+	l := &laneSet[T]{
+		queues:    make([]chan entry[T], len(lanes)),
+		weights:   make([]int, len(lanes)),
+		current:   make([]int, len(lanes)),
+		flushReqs: make(chan chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for i, lane := range lanes {
+		size := lane.QueueSize
+		if size <= 0 {
+			size = queueSize
+		}
+		l.queues[i] = make(chan entry[T], size)
+		l.weights[i] = max(lane.Weight, 1)
+	}
+	return l
+}
+
+// pick returns the lane to serve next among those with waiting[i] > 0, or
+// -1 if there is none. A nil waiting uses the current length of each lane.
+func (l *laneSet[T]) pick(waiting []int) int {
+	best, total := -1, 0
+	for i, q := range l.queues {
+		if (waiting == nil && len(q) == 0) || (waiting != nil && waiting[i] == 0) {
+			continue
+		}
+		l.current[i] += l.weights[i]
+		total += l.weights[i]
+		if best < 0 || l.current[i] > l.current[best] {
+			best = i
+		}
+	}
+	if best >= 0 {
+		l.current[best] -= total
+	}
+	return best
+}
+
+// AddWithPriority 添加数据到指定优先级通道，priority为BatchConfig.Lanes的下标
+func (c *ChanBatcherInstance[T]) AddWithPriority(item T, priority int) error {
+	lanes := 1
+	if c.lanes != nil {
+		lanes = len(c.lanes.queues)
+	}
+	if priority < 0 || priority >= lanes {
+		return ErrInvalidPriority
+	}
+	return c.enqueue(entry[T]{item: item, lane: priority})
+}
+
+// dispatchLanes moves items from the lanes to the worker queues until the
+// batcher stops
+func (c *ChanBatcherInstance[T]) dispatchLanes() {
+	l := c.lanes
+	// Used once every lane is empty: wait for the stop, a flush or any item
+	cases := make([]reflect.SelectCase, 2+len(l.queues))
+	cases[0] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.ctx.Done())}
+	cases[1] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(l.flushReqs)}
+	for i, q := range l.queues {
+		cases[2+i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(q)}
+	}
+
+	for {
+		select {
+		case done := <-l.flushReqs:
+			if !c.flushLanes() {
+				return
+			}
+			close(done)
+			continue
+		default:
+		}
+
+		var e entry[T]
+		if i := l.pick(nil); i >= 0 {
+			// The dispatcher is the only receiver, a non-empty lane stays non-empty
+			e = <-l.queues[i]
+		} else {
+			chosen, v, _ := reflect.Select(cases)
+			switch chosen {
+			case 0:
+				return
+			case 1:
+				if !c.flushLanes() {
+					return
+				}
+				close(v.Interface().(chan struct{}))
+				continue
+			default:
+				e = v.Interface().(entry[T])
+			}
+		}
+		if !c.handOff(e) {
+			return
+		}
+	}
+}
+
+// flushLanes hands every item currently in a lane to the workers, keeping
+// to the lane weights
+func (c *ChanBatcherInstance[T]) flushLanes() bool {
+	l := c.lanes
+	waiting := make([]int, len(l.queues))
+	for i, q := range l.queues {
+		waiting[i] = len(q)
+	}
+	for i := l.pick(waiting); i >= 0; i = l.pick(waiting) {
+		waiting[i]--
+		if !c.handOff(<-l.queues[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// handOff blocks until a worker queue takes e, or fails e once the batcher stops
+func (c *ChanBatcherInstance[T]) handOff(e entry[T]) bool {
+	select {
+	case c.routeFor(&e) <- e:
+		return true
+	case <-c.ctx.Done():
+		c.fail([]entry[T]{e}, ErrBatcherStopped)
+		return false
+	}
+}
+
+// waitLanes asks the dispatcher to hand over everything that is in the lanes
+// right now and waits for it
+func (c *ChanBatcherInstance[T]) waitLanes(stop <-chan struct{}) bool {
+	if c.lanes == nil {
+		return true
+	}
+	done := make(chan struct{})
+	select {
+	case c.lanes.flushReqs <- done:
+	case <-c.lanes.done:
+		return true
+	case <-stop:
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-c.lanes.done:
+		return true
+	case <-stop:
+		return false
+	}
+}
@@ -0,0 +1,95 @@
+package batchy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// fullInterval is the interval scale at which workers use their whole Timeout
+	fullInterval = 1024
+	// minInterval bounds how far the controller shrinks the flush interval, Timeout/16
+	minInterval = fullInterval / 16
+	// intervalStep is the additive increase of the interval scale, Timeout/32
+	intervalStep = fullInterval / 32
+)
+
+// latencyController adapts the batch size and the flush interval with
+// additive-increase/multiplicative-decrease. A batch that exceeds a latency
+// target halves both; a batch within the targets grows the interval back
+// towards Timeout and, if it was full, the batch size towards MaxBatchSize.
+type latencyController struct {
+	target     time.Duration // Processor duration target, 0 when unused
+	itemTarget time.Duration // Enqueue to outcome target, 0 when unused
+	minSize    int
+	maxSize    int
+	sizeStep   int
+
+	mu       sync.Mutex // Serializes updates, reads use the atomics
+	size     atomic.Int64
+	interval atomic.Int64 // Scale of the workers' Timeout, fullInterval is 100%
+}
+
+func newLatencyController(target, itemTarget time.Duration, batchSize, minSize, maxSize int) *latencyController {
+	l := &latencyController{
+		target:     target,
+		itemTarget: itemTarget,
+	}
+	l.setBounds(batchSize, minSize, maxSize)
+	l.interval.Store(fullInterval)
+	return l
+}
+
+// setBounds restarts the controller from batchSize within new size bounds
+func (l *latencyController) setBounds(batchSize, minSize, maxSize int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.minSize = minSize
+	l.maxSize = max(maxSize, minSize)
+	l.sizeStep = max((l.maxSize-minSize)/16, 1)
+	l.size.Store(int64(min(max(batchSize, minSize), l.maxSize)))
+}
+
+// batchSize returns the current target batch size
+func (l *latencyController) batchSize() int {
+	return int(l.size.Load())
+}
+
+// scale returns timeout shrunk by the current interval scale
+func (l *latencyController) scale(timeout time.Duration) time.Duration {
+	return timeout * time.Duration(l.interval.Load()) / fullInterval
+}
+
+// observe feeds back one processor call: its duration, the age of its oldest
+// item when the call returned and how many items it held
+func (l *latencyController) observe(duration, age time.Duration, items int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size := int(l.size.Load())
+	interval := l.interval.Load()
+	if (l.target > 0 && duration > l.target) || (l.itemTarget > 0 && age > l.itemTarget) {
+		l.size.Store(int64(max(size/2, l.minSize)))
+		l.interval.Store(max(interval/2, minInterval))
+		return
+	}
+	// Growing the size only helps if the limit was what ended the batch
+	if items >= size {
+		l.size.Store(int64(min(size+l.sizeStep, l.maxSize)))
+	}
+	l.interval.Store(min(interval+intervalStep, fullInterval))
+}
+
+// interval returns the worker's flush timeout, scaled by the latency
+// controller when latency targets are set
+func (w *batchWorker[T]) interval() time.Duration {
+	if l := w.c.limits.Load(); l != w.limits {
+		// Each worker gets its own jittered timeout to prevent thundering herd
+		w.limits = l
+		w.timeout = w.c.generateJitteredTimeout(w.id, l.timeout)
+	}
+	if w.c.latency == nil {
+		return w.timeout
+	}
+	return w.c.latency.scale(w.timeout)
+}
@@ -0,0 +1,190 @@
+package batchy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrKeyNotFound is returned by Loader.Load when fetch did not return the key
+	ErrKeyNotFound = errors.New("batchy: key not found")
+	// ErrLoaderNotPersistent is returned when a Loader is configured with
+	// Durability or OVERFLOW_SPILL_TO_DISK, its pending loads cannot be written to disk
+	ErrLoaderNotPersistent = errors.New("Loader supports neither Durability nor OVERFLOW_SPILL_TO_DISK")
+)
+
+// Loader batches the keys requested by concurrent Load calls into a single
+// fetch and hands every caller the value of its key (dataloader pattern).
+// Loads of a key that is already waiting or being fetched share that fetch.
+// Values are not cached once their fetch has returned.
+type Loader[K comparable, V any] struct {
+	fetch   func(ctx context.Context, keys []K) (map[K]V, error)
+	batcher *ChanBatcherInstance[*loadCall[K, V]]
+
+	mu    sync.Mutex
+	calls map[K]*loadCall[K, V] // Keys that are waiting or being fetched
+}
+
+// loadCall is the fetch of one key shared by the loads waiting for it
+type loadCall[K comparable, V any] struct {
+	key    K
+	future *Future
+	// Written by the processor before the future resolves, an abandoned
+	// fetch may still write it afterwards
+	value atomic.Pointer[V]
+	// Bounds the wait for queue space, canceled once every load waiting for
+	// the call has left
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Loads waiting for the call, guarded by Loader.mu
+	waiters int
+}
+
+// NewLoader 创建批量加载器，并发的Load调用合并为一次fetch，同一key只加载一次。
+// fetch返回的map中缺少的key以ErrKeyNotFound作为结果，fetch返回错误时该批所有key都以该错误作为结果。
+func NewLoader[K comparable, V any](
+	fetch func(ctx context.Context, keys []K) (map[K]V, error),
+	batchConfig BatchConfig,
+) (*Loader[K, V], error) {
+	if fetch == nil {
+		return nil, ErrProcessorNotSet
+	}
+	if batchConfig.Durability != DURABILITY_NONE || batchConfig.OverflowPolicy == OVERFLOW_SPILL_TO_DISK {
+		return nil, ErrLoaderNotPersistent
+	}
+	// A missing key will not turn up by fetching it again
+	retryable := batchConfig.IsRetryable
+	batchConfig.IsRetryable = func(err error) bool {
+		return !errors.Is(err, ErrKeyNotFound) && (retryable == nil || retryable(err))
+	}
+
+	l := &Loader[K, V]{
+		fetch: fetch,
+		calls: make(map[K]*loadCall[K, V]),
+	}
+	instance, err := newChanBatcher(l.process, batchConfig, buildOptions[*loadCall[K, V]](nil))
+	if err != nil {
+		return nil, err
+	}
+	l.batcher = instance
+	return l, nil
+}
+
+// Load 返回key对应的值，阻塞到包含该key的批次fetch返回或ctx结束。
+// 队列满时的行为由OverflowPolicy决定，最多阻塞到ctx结束。
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	var zero V
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	l.mu.Lock()
+	call, joined := l.calls[key]
+	if !joined {
+		call = &loadCall[K, V]{key: key, future: newFuture()}
+		// Keeps the values of ctx, but ends only once every load waiting
+		// for the call has left, not when this caller does
+		call.ctx, call.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		call.future.then = func() {
+			l.forget(call)
+			call.cancel()
+		}
+		l.calls[key] = call
+	}
+	call.waiters++
+	l.mu.Unlock()
+
+	if !joined {
+		// The fetch runs under the batcher's context and is not canceled
+		// when this caller leaves
+		e := entry[*loadCall[K, V]]{item: call, future: call.future, ctx: call.ctx}
+		if err := l.batcher.offer(e, false); errors.Is(err, ErrQueueFull) {
+			// Waiting for queue space must not keep this caller past its ctx,
+			// loads that join meanwhile may still wait for the call
+			go func() {
+				if err := l.batcher.enqueue(e); err != nil {
+					call.future.resolve(err)
+				}
+			}()
+		} else if err != nil {
+			call.future.resolve(err)
+		}
+	}
+	select {
+	case <-call.future.Done():
+	case <-ctx.Done():
+		l.leave(call)
+		return zero, ctx.Err()
+	}
+	if err := call.future.Wait(); err != nil {
+		return zero, err
+	}
+	return *call.value.Load(), nil
+}
+
+// leave drops a load that stopped waiting for call. Once the last one has
+// left, later loads of the key start a new call and a call still waiting for
+// queue space gives up.
+func (l *Loader[K, V]) leave(call *loadCall[K, V]) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	call.waiters--
+	if call.waiters > 0 {
+		return
+	}
+	if l.calls[call.key] == call {
+		delete(l.calls, call.key)
+	}
+	call.cancel()
+}
+
+// forget removes a resolved call, later loads of its key fetch it again
+func (l *Loader[K, V]) forget(call *loadCall[K, V]) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.calls[call.key] == call {
+		delete(l.calls, call.key)
+	}
+}
+
+// process fetches the keys of one batch and stores the value of each call
+func (l *Loader[K, V]) process(ctx context.Context, batch Batch[*loadCall[K, V]]) []error {
+	keys := make([]K, len(batch.Items))
+	for i, call := range batch.Items {
+		keys[i] = call.key
+	}
+	values, err := l.fetch(ctx, keys)
+	errs := make([]error, len(batch.Items))
+	for i, call := range batch.Items {
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		v, ok := values[call.key]
+		if !ok {
+			errs[i] = ErrKeyNotFound
+			continue
+		}
+		call.value.Store(&v)
+	}
+	return errs
+}
+
+// Stats returns a snapshot of the underlying batcher's runtime counters
+func (l *Loader[K, V]) Stats() Stats {
+	return l.batcher.Stats()
+}
+
+// Shutdown 停止接收新的Load，等待已提交的key加载完成
+func (l *Loader[K, V]) Shutdown(ctx context.Context) error {
+	return l.batcher.Shutdown(ctx)
+}
+
+// Stop 立即停止，尚未开始fetch的Load返回ErrBatcherStopped
+func (l *Loader[K, V]) Stop() {
+	l.batcher.Stop()
+}
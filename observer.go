@@ -0,0 +1,45 @@
+package batchy
+
+import (
+	"context"
+	"time"
+)
+
+// BatchInfo describes one completed processor invocation
+type BatchInfo struct {
+	// WorkerID is the worker that ran the batch
+	WorkerID int
+	// Size is the number of items handed to the processor
+	Size int
+	// Trigger is why the batch was emitted
+	Trigger FlushTrigger
+	// Duration is how long the processor call took, or had run so far when
+	// OnSlowBatch reports a call that has not returned yet
+	Duration time.Duration
+	// Failed is the number of items the processor reported an error for,
+	// some of which may still be retried
+	Failed int
+}
+
+// BatchTracer starts a span around every processor invocation. links holds
+// the context each item of the batch was added with via AddContext, nil for
+// items added without one. The returned function ends the span and receives
+// the completed BatchInfo. It is called from worker goroutines and must be
+// safe for concurrent use.
+type BatchTracer interface {
+	StartBatch(ctx context.Context, info BatchInfo, links []context.Context) (end func(BatchInfo))
+}
+
+// BatchContextTracer is a BatchTracer that also returns the context carrying
+// its span. A ContextProcessor runs with that context, so the spans it starts
+// become children of the batch span.
+type BatchContextTracer interface {
+	BatchTracer
+	StartBatchContext(ctx context.Context, info BatchInfo, links []context.Context) (context.Context, func(BatchInfo))
+}
+
+// BatchObserver is notified after every processor invocation. It is called
+// from worker goroutines and must be safe for concurrent use.
+type BatchObserver interface {
+	ObserveBatch(info BatchInfo)
+}
@@ -0,0 +1,27 @@
+package batchy
+
+// Option configures the parts of a batcher that depend on the item type and
+// therefore cannot live in the non-generic BatchConfig
+type Option[T any] func(*options[T])
+
+type options[T any] struct {
+	deadLetter DeadLetterSink[T]
+	// Set by NewKeyedBatcher, not exposed as an Option
+	keyFn        func(T) any
+	partitionKey func(T) any
+	codec        Codec[T]
+	weightFn     func(T) int
+	coalesceKey  func(T) any
+	merge        func(old, new T) T
+	fallback     Processor[T]
+}
+
+func buildOptions[T any](opts []Option[T]) options[T] {
+	var o options[T]
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
@@ -0,0 +1,24 @@
+module github.com/PaienNate/batchy/otel
+
+go 1.21
+
+require (
+	github.com/PaienNate/batchy v0.0.0-20261016141047-b3fbd171614a
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/panjf2000/ants/v2 v2.11.3 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
+
+// Builds against the local checkout during development, modules depending
+// on this one ignore the replace and use the version required above
+replace github.com/PaienNate/batchy => ../
@@ -0,0 +1,134 @@
+// Package otel traces batchy processor invocations with OpenTelemetry.
+//
+// Every processor call runs under a span that links to the span of each
+// request that contributed an item through AddContext, so a slow batch can be
+// traced back to the requests it contained.
+//
+//	config.Tracer = otel.NewTracer(otel.WithBatcherName("orders"))
+//	b, _ := batchy.NewChanBatcher[Order](processor, config)
+//	b.AddContext(r.Context(), order)
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PaienNate/batchy"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/PaienNate/batchy/otel"
+
+// SpanName is the name of the span started for each processor invocation
+const SpanName = "batchy.process"
+
+// Attribute keys recorded on batch spans
+const (
+	BatcherKey  = attribute.Key("batchy.batcher")
+	WorkerKey   = attribute.Key("batchy.worker.id")
+	SizeKey     = attribute.Key("batchy.batch.size")
+	TriggerKey  = attribute.Key("batchy.batch.trigger")
+	FailedKey   = attribute.Key("batchy.batch.failed")
+	DurationKey = attribute.Key("batchy.processor.duration_ms")
+)
+
+// Tracer implements batchy.BatchTracer on top of an OpenTelemetry tracer
+type Tracer struct {
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue
+}
+
+// Option configures a Tracer
+type Option func(*config)
+
+type config struct {
+	provider trace.TracerProvider
+	name     string
+}
+
+// WithTracerProvider uses tp instead of the global tracer provider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = tp
+	}
+}
+
+// WithBatcherName records name on every span, to tell batchers apart
+func WithBatcherName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// NewTracer creates a batchy.BatchTracer
+func NewTracer(opts ...Option) *Tracer {
+	cfg := config{provider: otel.GetTracerProvider()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	t := &Tracer{tracer: cfg.provider.Tracer(instrumentationName)}
+	if cfg.name != "" {
+		t.attrs = append(t.attrs, BatcherKey.String(cfg.name))
+	}
+	return t
+}
+
+// StartBatch implements batchy.BatchTracer
+func (t *Tracer) StartBatch(ctx context.Context, info batchy.BatchInfo, links []context.Context) func(batchy.BatchInfo) {
+	_, end := t.StartBatchContext(ctx, info, links)
+	return end
+}
+
+// StartBatchContext implements batchy.BatchContextTracer, a ContextProcessor
+// receives the returned context and can start child spans from it
+func (t *Tracer) StartBatchContext(ctx context.Context, info batchy.BatchInfo, links []context.Context) (context.Context, func(batchy.BatchInfo)) {
+	// Many items usually come from the same request, link each span once
+	type spanKey struct {
+		trace trace.TraceID
+		span  trace.SpanID
+	}
+	seen := make(map[spanKey]struct{}, len(links))
+	spanLinks := make([]trace.Link, 0, len(links))
+	for _, l := range links {
+		if l == nil {
+			continue
+		}
+		sc := trace.SpanContextFromContext(l)
+		if !sc.IsValid() {
+			continue
+		}
+		key := spanKey{sc.TraceID(), sc.SpanID()}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		spanLinks = append(spanLinks, trace.Link{SpanContext: sc})
+	}
+
+	attrs := append([]attribute.KeyValue{
+		WorkerKey.Int(info.WorkerID),
+		SizeKey.Int(info.Size),
+		TriggerKey.String(info.Trigger.String()),
+	}, t.attrs...)
+
+	ctx, span := t.tracer.Start(ctx, SpanName,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithLinks(spanLinks...),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx, func(done batchy.BatchInfo) {
+		span.SetAttributes(
+			FailedKey.Int(done.Failed),
+			DurationKey.Float64(float64(done.Duration.Microseconds())/1000),
+		)
+		if done.Failed > 0 {
+			span.SetStatus(codes.Error, fmt.Sprintf("%d of %d items failed", done.Failed, done.Size))
+		}
+		span.End()
+	}
+}
+
+var _ batchy.BatchContextTracer = (*Tracer)(nil)
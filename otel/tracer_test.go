@@ -0,0 +1,146 @@
+package otel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PaienNate/batchy"
+	batchyotel "github.com/PaienNate/batchy/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestBatchSpanLinksItemSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := tp.Tracer("test")
+
+	processor := func(items []int) []error {
+		errs := make([]error, len(items))
+		errs[0] = errors.New("first item failed")
+		return errs
+	}
+	b, err := batchy.NewChanBatcher[int](processor, batchy.BatchConfig{
+		BatchSize: 4,
+		PoolSize:  1,
+		Timeout:   time.Hour,
+		Tracer: batchyotel.NewTracer(
+			batchyotel.WithTracerProvider(tp),
+			batchyotel.WithBatcherName("orders"),
+		),
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	// 三个请求贡献四条数据，其中一个请求贡献两条，另一条数据没有context
+	var requests []trace.SpanContext
+	for i := 0; i < 3; i++ {
+		ctx, span := tracer.Start(context.Background(), "request")
+		requests = append(requests, span.SpanContext())
+		if err := b.AddContext(ctx, i); err != nil {
+			t.Fatalf("AddContext失败: %v", err)
+		}
+		if i == 0 {
+			b.AddContext(ctx, 100)
+		}
+		span.End()
+	}
+	// 等待按批大小触发的批次完成
+	deadline := time.Now().Add(2 * time.Second)
+	for st := b.Stats(); st.Processed+st.Failed < 4; st = b.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("批次未在预期时间内处理: %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// span在处理结果统计之后结束
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+
+	var batchSpan sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.Name() == batchyotel.SpanName {
+			batchSpan = s
+		}
+	}
+	if batchSpan == nil {
+		t.Fatal("未找到批次span")
+	}
+
+	links := batchSpan.Links()
+	if len(links) != len(requests) {
+		t.Fatalf("期望 %d 个链接（同一请求只链接一次）, 实际 %d", len(requests), len(links))
+	}
+	for i, l := range links {
+		if !l.SpanContext.Equal(requests[i]) {
+			t.Errorf("第 %d 个链接指向 %v, 期望 %v", i, l.SpanContext.SpanID(), requests[i].SpanID())
+		}
+	}
+
+	attrs := attribute.NewSet(batchSpan.Attributes()...)
+	expect := map[attribute.Key]attribute.Value{
+		batchyotel.BatcherKey: attribute.StringValue("orders"),
+		batchyotel.SizeKey:    attribute.IntValue(4),
+		batchyotel.TriggerKey: attribute.StringValue(batchy.TRIGGER_SIZE.String()),
+		batchyotel.FailedKey:  attribute.IntValue(1),
+	}
+	for k, want := range expect {
+		if got, ok := attrs.Value(k); !ok || got != want {
+			t.Errorf("属性 %s 期望 %v, 实际 %v", k, want.Emit(), got.Emit())
+		}
+	}
+	if batchSpan.Status().Code != codes.Error {
+		t.Errorf("有失败数据时span状态应为Error, 实际 %v", batchSpan.Status())
+	}
+}
+
+func TestContextProcessorSpansAreChildren(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := tp.Tracer("test")
+
+	b, err := batchy.NewChanBatcherContext[int](func(ctx context.Context, batch batchy.Batch[int]) []error {
+		_, span := tracer.Start(ctx, "db.insert")
+		span.End()
+		return nil
+	}, batchy.BatchConfig{
+		BatchSize: 2,
+		PoolSize:  1,
+		Timeout:   time.Hour,
+		Tracer:    batchyotel.NewTracer(batchyotel.WithTracerProvider(tp)),
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	b.Add(1)
+	b.Add(2)
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+
+	var batchSpan, child sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		switch s.Name() {
+		case batchyotel.SpanName:
+			batchSpan = s
+		case "db.insert":
+			child = s
+		}
+	}
+	if batchSpan == nil || child == nil {
+		t.Fatal("未找到批次span或处理器span")
+	}
+	if child.Parent().SpanID() != batchSpan.SpanContext().SpanID() {
+		t.Errorf("处理器span的父span应为批次span")
+	}
+}
@@ -0,0 +1,126 @@
+package batchy
+
+import "errors"
+
+var (
+	// ErrQueueFull is returned when the queue is full and the item could not
+	// be enqueued without blocking
+	ErrQueueFull = errors.New("batchy: queue is full")
+	// ErrItemDropped resolves the Future of an item discarded by a drop policy
+	ErrItemDropped = errors.New("batchy: item dropped by overflow policy")
+	// ErrInvalidOverflowPolicy is returned for an unknown OverflowPolicy
+	ErrInvalidOverflowPolicy = errors.New("invalid overflow policy")
+)
+
+// OverflowPolicy defines what Add does when the queue is full
+type OverflowPolicy int
+
+const (
+	// OVERFLOW_BLOCK blocks until space frees up (default)
+	OVERFLOW_BLOCK OverflowPolicy = iota
+	// OVERFLOW_DROP_NEWEST discards the item being added
+	OVERFLOW_DROP_NEWEST
+	// OVERFLOW_DROP_OLDEST discards the oldest queued item to make room
+	OVERFLOW_DROP_OLDEST
+	// OVERFLOW_RETURN_ERROR rejects the item with ErrQueueFull
+	OVERFLOW_RETURN_ERROR
+	// OVERFLOW_SPILL_TO_DISK writes the item to a spill file in SpillDir that
+	// is read back once the queue has room, and blocks once SpillMaxBytes is used up
+	OVERFLOW_SPILL_TO_DISK
+)
+
+func (p OverflowPolicy) valid() bool {
+	return p >= OVERFLOW_BLOCK && p <= OVERFLOW_SPILL_TO_DISK
+}
+
+// TryAdd 非阻塞添加，返回数据是否进入队列
+func (c *ChanBatcherInstance[T]) TryAdd(item T) bool {
+	return c.offer(entry[T]{item: item}, false) == nil
+}
+
+// overflow handles an accepted entry that found its queue q full. When wait is
+// false nothing may block: policies that would block or drop the new item
+// reject it with ErrQueueFull instead.
+func (c *ChanBatcherInstance[T]) overflow(q chan entry[T], e entry[T], wait bool, callerDone <-chan struct{}) error {
+	switch c.overflowPolicy {
+	case OVERFLOW_DROP_OLDEST:
+		for {
+			select {
+			case q <- e:
+				return nil
+			default:
+			}
+			// Another worker may have emptied the queue meanwhile, retry the send
+			select {
+			case old := <-q:
+				c.ackEntries([]entry[T]{old})
+				c.fail([]entry[T]{old}, ErrItemDropped)
+			default:
+			}
+		}
+	case OVERFLOW_DROP_NEWEST:
+		if !wait {
+			c.unaccept(&e)
+			return ErrQueueFull
+		}
+		c.ackEntries([]entry[T]{e})
+		c.fail([]entry[T]{e}, ErrItemDropped)
+		return nil
+	case OVERFLOW_RETURN_ERROR:
+		c.unaccept(&e)
+		return ErrQueueFull
+	case OVERFLOW_SPILL_TO_DISK:
+		spill := c.spills[e.lane]
+		for {
+			changed := spill.watch()
+			spilled, err := spill.push(&e)
+			if err != nil {
+				c.unaccept(&e)
+				return err
+			}
+			if spilled {
+				return nil
+			}
+			// Over the disk budget. Sending to the queue would overtake the
+			// spilled items, so wait for the drain to make room on disk
+			// until the spill is empty and the queue is next in line.
+			if spill.backlog() == 0 {
+				break
+			}
+			if !wait {
+				c.unaccept(&e)
+				return ErrQueueFull
+			}
+			select {
+			case <-changed:
+			case <-c.closing:
+				c.unaccept(&e)
+				return ErrBatcherStopped
+			case <-c.ctx.Done():
+				c.unaccept(&e)
+				return ErrBatcherStopped
+			case <-callerDone:
+				c.unaccept(&e)
+				return e.ctx.Err()
+			}
+		}
+	}
+
+	if !wait {
+		c.unaccept(&e)
+		return ErrQueueFull
+	}
+	select {
+	case <-c.closing:
+		c.unaccept(&e)
+		return ErrBatcherStopped
+	case <-c.ctx.Done():
+		c.unaccept(&e)
+		return ErrBatcherStopped
+	case <-callerDone:
+		c.unaccept(&e)
+		return e.ctx.Err()
+	case q <- e: // 关键点：channel满时会自动阻塞
+		return nil
+	}
+}
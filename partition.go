@@ -0,0 +1,101 @@
+package batchy
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+)
+
+// ErrPartitionKeyNotSet is returned when KEY_HASH is used without a partition key
+var ErrPartitionKeyNotSet = errors.New("KEY_HASH scheduling requires a partition key")
+
+// WithPartitionKey sets the key KEY_HASH and keyed batchers route by. Items with equal keys go
+// to the same worker and are handed to the processor in the order they were
+// added, a failed item is retried before later items of its worker.
+// Keyed batchers route by their batching key when this option is not given.
+func WithPartitionKey[T any, K comparable](keyFn func(T) K) Option[T] {
+	return func(o *options[T]) {
+		if keyFn == nil {
+			return
+		}
+		o.partitionKey = func(item T) any {
+			return keyFn(item)
+		}
+	}
+}
+
+// hashKey maps a partition key to a stable hash. Keys that are neither strings
+// nor integers are hashed through their %v representation.
+func hashKey(key any) uint32 {
+	h := fnv.New32a()
+	switch k := key.(type) {
+	case string:
+		_, _ = io.WriteString(h, k)
+	default:
+		_, _ = fmt.Fprintf(h, "%v", k)
+	}
+	return h.Sum32()
+}
+
+// queueFor returns the queue e enters the batcher through: its priority lane
+// if lanes are configured, otherwise the queue of the worker it is routed to
+func (c *ChanBatcherInstance[T]) queueFor(e *entry[T]) chan entry[T] {
+	if c.lanes != nil {
+		return c.lanes.queues[e.lane]
+	}
+	return c.routeFor(e)
+}
+
+// ordered reports whether items have to reach the processor in the order
+// they were routed to their worker, so that no batch may overtake another
+func (c *ChanBatcherInstance[T]) ordered() bool {
+	return c.schedulingPolicy != ROUND_ROBIN
+}
+
+// partitions reports whether policy gives every worker its own queue and
+// routes items to workers by key, which is the case under KEY_HASH and for
+// keyed batchers under ROUND_ROBIN
+func partitions(policy SchedulingPolicy, keyed bool) bool {
+	return policy == KEY_HASH || (keyed && policy == ROUND_ROBIN)
+}
+
+// partitioned reports whether items are routed to workers by key
+func (c *ChanBatcherInstance[T]) partitioned() bool {
+	return partitions(c.schedulingPolicy, c.keyFn != nil)
+}
+
+// routeFor returns the worker queue e has to be sent to
+func (c *ChanBatcherInstance[T]) routeFor(e *entry[T]) chan entry[T] {
+	if !c.partitioned() {
+		return c.queues[0]
+	}
+	key := e.key
+	if c.partitionKey != nil {
+		key = c.partitionKey(e.item)
+	}
+	return c.queues[hashKey(key)%uint32(len(c.queues))]
+}
+
+// distinctQueues returns every queue an entry can wait in once: the priority
+// lanes and the worker queues, which are shared unless partitioned
+func (c *ChanBatcherInstance[T]) distinctQueues() []chan entry[T] {
+	queues := c.queues
+	if !c.partitioned() {
+		queues = c.queues[:1]
+	}
+	if c.lanes != nil {
+		return append(slices.Clip(c.lanes.queues), queues...)
+	}
+	return queues
+}
+
+// queueDepth returns the total length and capacity of the queues
+func (c *ChanBatcherInstance[T]) queueDepth() (length, capacity int) {
+	for _, q := range c.distinctQueues() {
+		length += len(q)
+		capacity += cap(q)
+	}
+	return length, capacity
+}
@@ -0,0 +1,158 @@
+// Package prometheus exports the runtime state of batchy batchers as
+// Prometheus metrics.
+//
+//	m := prometheus.New("orders")
+//	config.Observer = m
+//	b, _ := batchy.NewChanBatcher[Order](processor, config)
+//	m.Attach(b)
+//	registry.MustRegister(m)
+package prometheus
+
+import (
+	"sync"
+
+	"github.com/PaienNate/batchy"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "batchy"
+
+// StatsSource is implemented by every batchy.Batcher
+type StatsSource interface {
+	Stats() batchy.Stats
+}
+
+// Metrics collects the metrics of one named batcher. It implements
+// batchy.BatchObserver to record per-batch histograms and prometheus.Collector
+// to expose them together with the batcher's Stats().
+type Metrics struct {
+	batchSize       prom.Histogram
+	processDuration prom.Histogram
+
+	queueDepth    *prom.Desc
+	queueCapacity *prom.Desc
+	spilled       *prom.Desc
+	breaker       *prom.Desc
+	inFlight      *prom.Desc
+	abandoned     *prom.Desc
+	workers       *prom.Desc
+	items         *prom.Desc
+	batches       *prom.Desc
+
+	mu     sync.RWMutex
+	source StatsSource
+}
+
+// New creates the metrics of the batcher called name, every metric carries
+// it in the "batcher" label
+func New(name string) *Metrics {
+	labels := prom.Labels{"batcher": name}
+	return &Metrics{
+		batchSize: prom.NewHistogram(prom.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "batch_size",
+			Help:        "Number of items handed to the processor per batch.",
+			ConstLabels: labels,
+			Buckets:     prom.ExponentialBuckets(1, 2, 14),
+		}),
+		processDuration: prom.NewHistogram(prom.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "processor_duration_seconds",
+			Help:        "Duration of processor calls.",
+			ConstLabels: labels,
+			Buckets:     prom.ExponentialBuckets(0.0005, 2, 16),
+		}),
+		queueDepth: prom.NewDesc(prom.BuildFQName(namespace, "", "queue_depth"),
+			"Items waiting in the queue.", nil, labels),
+		queueCapacity: prom.NewDesc(prom.BuildFQName(namespace, "", "queue_capacity"),
+			"Capacity of the queue.", nil, labels),
+		spilled: prom.NewDesc(prom.BuildFQName(namespace, "", "spilled_items"),
+			"Items spilled to disk that have not been read back into the queue.", nil, labels),
+		breaker: prom.NewDesc(prom.BuildFQName(namespace, "", "breaker_state"),
+			"Circuit breaker state: 0 closed, 1 open, 2 half-open.", nil, labels),
+		inFlight: prom.NewDesc(prom.BuildFQName(namespace, "", "inflight_batches"),
+			"Batches whose processor call is running.", nil, labels),
+		abandoned: prom.NewDesc(prom.BuildFQName(namespace, "", "abandoned_batches"),
+			"Processor calls abandoned after ProcessTimeout that are still running.", nil, labels),
+		workers: prom.NewDesc(prom.BuildFQName(namespace, "", "workers"),
+			"Live worker goroutines.", nil, labels),
+		items: prom.NewDesc(prom.BuildFQName(namespace, "", "items_total"),
+			"Items by outcome: added, processed, failed, dropped, retried, coalesced or timed_out.", []string{"outcome"}, labels),
+		batches: prom.NewDesc(prom.BuildFQName(namespace, "", "batches_total"),
+			"Batches by the trigger that emitted them.", []string{"trigger"}, labels),
+	}
+}
+
+// Attach sets the batcher whose Stats() feed the gauges and counters
+func (m *Metrics) Attach(source StatsSource) {
+	m.mu.Lock()
+	m.source = source
+	m.mu.Unlock()
+}
+
+// ObserveBatch implements batchy.BatchObserver
+func (m *Metrics) ObserveBatch(info batchy.BatchInfo) {
+	m.batchSize.Observe(float64(info.Size))
+	m.processDuration.Observe(info.Duration.Seconds())
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prom.Desc) {
+	m.batchSize.Describe(ch)
+	m.processDuration.Describe(ch)
+	ch <- m.queueDepth
+	ch <- m.queueCapacity
+	ch <- m.spilled
+	ch <- m.breaker
+	ch <- m.inFlight
+	ch <- m.abandoned
+	ch <- m.workers
+	ch <- m.items
+	ch <- m.batches
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prom.Metric) {
+	m.batchSize.Collect(ch)
+	m.processDuration.Collect(ch)
+
+	m.mu.RLock()
+	source := m.source
+	m.mu.RUnlock()
+	if source == nil {
+		return
+	}
+
+	st := source.Stats()
+	ch <- prom.MustNewConstMetric(m.queueDepth, prom.GaugeValue, float64(st.QueueLength))
+	ch <- prom.MustNewConstMetric(m.queueCapacity, prom.GaugeValue, float64(st.QueueCapacity))
+	ch <- prom.MustNewConstMetric(m.spilled, prom.GaugeValue, float64(st.Spilled))
+	ch <- prom.MustNewConstMetric(m.breaker, prom.GaugeValue, float64(st.Breaker))
+	ch <- prom.MustNewConstMetric(m.inFlight, prom.GaugeValue, float64(st.InFlightBatches))
+	ch <- prom.MustNewConstMetric(m.abandoned, prom.GaugeValue, float64(st.AbandonedBatches))
+	ch <- prom.MustNewConstMetric(m.workers, prom.GaugeValue, float64(st.LiveWorkers))
+
+	outcomes := []struct {
+		name  string
+		value uint64
+	}{
+		{"added", st.Added},
+		{"processed", st.Processed},
+		{"failed", st.Failed},
+		{"dropped", st.Dropped},
+		{"retried", st.Retried},
+		{"coalesced", st.Coalesced},
+		{"timed_out", st.TimedOut},
+	}
+	for _, o := range outcomes {
+		ch <- prom.MustNewConstMetric(m.items, prom.CounterValue, float64(o.value), o.name)
+	}
+	for trigger, n := range st.Batches {
+		ch <- prom.MustNewConstMetric(m.batches, prom.CounterValue, float64(n), trigger.String())
+	}
+}
+
+var (
+	_ batchy.BatchObserver = (*Metrics)(nil)
+	_ prom.Collector       = (*Metrics)(nil)
+)
@@ -0,0 +1,117 @@
+package prometheus_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaienNate/batchy"
+	batchyprom "github.com/PaienNate/batchy/prometheus"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsExport(t *testing.T) {
+	m := batchyprom.New("orders")
+	reg := prom.NewPedanticRegistry()
+	if err := reg.Register(m); err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+
+	processor := func(items []int) []error {
+		errs := make([]error, len(items))
+		for i, item := range items {
+			if item%5 == 0 {
+				errs[i] = context.Canceled
+			}
+		}
+		return errs
+	}
+	b, err := batchy.NewChanBatcher[int](processor, batchy.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  2,
+		QueueSize: 100,
+		Timeout:   time.Hour,
+		Observer:  m,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+	m.Attach(b)
+
+	for i := 0; i < 25; i++ {
+		b.Add(i)
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+
+	expected := `
+# HELP batchy_items_total Items by outcome: added, processed, failed, dropped, retried, coalesced or timed_out.
+# TYPE batchy_items_total counter
+batchy_items_total{batcher="orders",outcome="added"} 25
+batchy_items_total{batcher="orders",outcome="coalesced"} 0
+batchy_items_total{batcher="orders",outcome="dropped"} 0
+batchy_items_total{batcher="orders",outcome="failed"} 5
+batchy_items_total{batcher="orders",outcome="processed"} 20
+batchy_items_total{batcher="orders",outcome="retried"} 0
+batchy_items_total{batcher="orders",outcome="timed_out"} 0
+# HELP batchy_queue_capacity Capacity of the queue.
+# TYPE batchy_queue_capacity gauge
+batchy_queue_capacity{batcher="orders"} 100
+# HELP batchy_queue_depth Items waiting in the queue.
+# TYPE batchy_queue_depth gauge
+batchy_queue_depth{batcher="orders"} 0
+# HELP batchy_inflight_batches Batches whose processor call is running.
+# TYPE batchy_inflight_batches gauge
+batchy_inflight_batches{batcher="orders"} 0
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"batchy_items_total", "batchy_queue_capacity", "batchy_queue_depth", "batchy_inflight_batches"); err != nil {
+		t.Error(err)
+	}
+
+	// 每个批次都记录了批大小和处理耗时
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather失败: %v", err)
+	}
+	var batchCount, sizeSum, durationCount uint64
+	for _, mf := range families {
+		switch mf.GetName() {
+		case "batchy_batches_total":
+			for _, metric := range mf.GetMetric() {
+				batchCount += uint64(metric.GetCounter().GetValue())
+			}
+		case "batchy_batch_size":
+			h := mf.GetMetric()[0].GetHistogram()
+			sizeSum = uint64(h.GetSampleSum())
+		case "batchy_processor_duration_seconds":
+			durationCount = mf.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	if sizeSum != 25 {
+		t.Errorf("batch_size 样本总和期望 25, 实际 %d", sizeSum)
+	}
+	if batchCount == 0 || durationCount != batchCount {
+		t.Errorf("批次数不一致: batches_total=%d, processor_duration样本=%d", batchCount, durationCount)
+	}
+	if n := testutil.CollectAndCount(m, "batchy_workers"); n != 1 {
+		t.Errorf("batchy_workers 期望 1 条, 实际 %d", n)
+	}
+}
+
+func TestMetricsMultipleBatchers(t *testing.T) {
+	reg := prom.NewRegistry()
+	for _, name := range []string{"a", "b"} {
+		m := batchyprom.New(name)
+		if err := reg.Register(m); err != nil {
+			t.Fatalf("注册 %s 失败: %v", name, err)
+		}
+	}
+	if _, err := reg.Gather(); err != nil {
+		t.Fatalf("未Attach时Gather失败: %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package batchy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrImmutableConfig is returned by Reconfigure for a field that can only be
+// set when the batcher is created
+var ErrImmutableConfig = errors.New("batchy: field cannot be changed by Reconfigure")
+
+// limits holds the settings Reconfigure can change while the batcher runs.
+// Workers load the current snapshot, Reconfigure swaps in a new one.
+type limits struct {
+	batchSize         int
+	timeout           time.Duration
+	dynamicBatching   bool
+	minBatchSize      int
+	maxBatchSize      int
+	adaptiveThreshold time.Duration
+	maxAttempts       int
+	retryBackoffBase  time.Duration
+	retryBackoffMax   time.Duration
+	processTimeout    time.Duration
+}
+
+// newLimits derives the live settings from cfg, filling in the defaults
+func newLimits(cfg BatchConfig) *limits {
+	l := &limits{
+		batchSize:         cfg.BatchSize,
+		timeout:           cfg.Timeout,
+		dynamicBatching:   cfg.DynamicBatching,
+		minBatchSize:      cfg.MinBatchSize,
+		maxBatchSize:      cfg.MaxBatchSize,
+		adaptiveThreshold: cfg.AdaptiveThreshold,
+		maxAttempts:       max(cfg.MaxAttempts, 1),
+		retryBackoffBase:  cfg.RetryBackoffBase,
+		retryBackoffMax:   cfg.RetryBackoffMax,
+		processTimeout:    max(cfg.ProcessTimeout, 0),
+	}
+	// Set up dynamic batching parameters
+	if l.minBatchSize <= 0 {
+		l.minBatchSize = max(cfg.BatchSize/4, 1)
+	}
+	if l.maxBatchSize <= 0 {
+		l.maxBatchSize = cfg.BatchSize * 4
+	}
+	if l.adaptiveThreshold <= 0 {
+		l.adaptiveThreshold = cfg.Timeout / 2
+	}
+	// Set up retry policy
+	if l.retryBackoffBase <= 0 {
+		l.retryBackoffBase = 100 * time.Millisecond
+	}
+	if l.retryBackoffMax <= 0 {
+		l.retryBackoffMax = 10 * time.Second
+	}
+	if l.retryBackoffMax < l.retryBackoffBase {
+		l.retryBackoffMax = l.retryBackoffBase
+	}
+	return l
+}
+
+// workerSlot is the handle of one running worker
+type workerSlot struct {
+	id       int
+	flush    chan chan struct{} // Flush requests, the worker closes the reply once flushed
+	retire   chan struct{}      // Closed by resize to ask the worker to leave
+	retiring bool               // Guarded by slotsMu
+	// Closed once the worker will not answer flush requests any more, a
+	// retiring worker closes it after emitting its buffer
+	gone     chan struct{}
+	goneOnce sync.Once
+}
+
+func (s *workerSlot) leave() {
+	s.goneOnce.Do(func() { close(s.gone) })
+}
+
+// Reconfigure 运行时调整批处理参数，无需重启且不会丢失数据。
+//
+// BatchSize, Timeout, PoolSize, DynamicBatching, MinBatchSize, MaxBatchSize,
+// AdaptiveThreshold, MaxAttempts, RetryBackoffBase, RetryBackoffMax and
+// ProcessTimeout apply from the next batch of every worker. Workers removed by a smaller PoolSize
+// emit their buffer and finish their pending retries before they exit. Every
+// other field must keep the value returned by Config, except for hooks and
+// Ctx, which are ignored. PoolSize is fixed under KEY_HASH and for keyed
+// batchers, where it decides the partitioning, and ORDERED_SEQUENTIAL always
+// runs one worker. With
+// autoscaling PoolSize is clamped to MinWorkers and MaxWorkers; both bounds,
+// ScaleInterval and ScaleDownIdle can change, but autoscaling cannot be
+// switched on or off.
+func (c *ChanBatcherInstance[T]) Reconfigure(cfg BatchConfig) error {
+	if cfg.PoolSize <= 0 {
+		return ErrWorkerNotSet
+	}
+	if cfg.Timeout == 0 {
+		return ErrInvalidTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if field := immutableChange(c.config, cfg); field != "" {
+		return fmt.Errorf("%w: %s", ErrImmutableConfig, field)
+	}
+	if c.partitioned() && cfg.PoolSize != c.config.PoolSize {
+		return fmt.Errorf("%w: PoolSize of a partitioned batcher", ErrImmutableConfig)
+	}
+	workers := cfg.PoolSize
+	if c.schedulingPolicy == ORDERED_SEQUENTIAL {
+		workers = 1
+	}
+	if cfg.MaxWorkers > 0 {
+		lo, hi, err := workerRange(cfg)
+		if err != nil {
+			return err
+		}
+		workers = min(max(workers, lo), hi)
+	}
+
+	// Workers must not be started once Shutdown() waits for them to exit
+	c.intakeMu.RLock()
+	defer c.intakeMu.RUnlock()
+	select {
+	case <-c.closing:
+		return ErrBatcherStopped
+	case <-c.ctx.Done():
+		return ErrBatcherStopped
+	default:
+	}
+
+	l := newLimits(cfg)
+	c.limits.Store(l)
+	if c.latency != nil {
+		c.latency.setBounds(l.batchSize, l.minBatchSize, l.maxBatchSize)
+	}
+	if err := c.resize(workers); err != nil {
+		return err
+	}
+
+	c.config.BatchSize = cfg.BatchSize
+	c.config.Timeout = cfg.Timeout
+	c.config.PoolSize = cfg.PoolSize
+	if cfg.MaxWorkers > 0 {
+		c.config.PoolSize = workers
+	}
+	c.config.DynamicBatching = cfg.DynamicBatching
+	c.config.MinBatchSize = cfg.MinBatchSize
+	c.config.MaxBatchSize = cfg.MaxBatchSize
+	c.config.AdaptiveThreshold = cfg.AdaptiveThreshold
+	c.config.MaxAttempts = cfg.MaxAttempts
+	c.config.RetryBackoffBase = cfg.RetryBackoffBase
+	c.config.RetryBackoffMax = cfg.RetryBackoffMax
+	c.config.ProcessTimeout = cfg.ProcessTimeout
+	c.config.MinWorkers = cfg.MinWorkers
+	c.config.MaxWorkers = cfg.MaxWorkers
+	c.config.ScaleInterval = cfg.ScaleInterval
+	c.config.ScaleDownIdle = cfg.ScaleDownIdle
+	return nil
+}
+
+// Config 返回当前生效的配置，修改后可以传给Reconfigure
+func (c *ChanBatcherInstance[T]) Config() BatchConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cfg := c.config
+	cfg.Lanes = slices.Clone(cfg.Lanes)
+	return cfg
+}
+
+// immutableChange returns the name of the first field Reconfigure cannot
+// change that differs between old and cfg, or "" if there is none
+func immutableChange(old, cfg BatchConfig) string {
+	switch {
+	case cfg.QueueSize != old.QueueSize:
+		return "QueueSize"
+	case cfg.SchedulingPolicy != old.SchedulingPolicy:
+		return "SchedulingPolicy"
+	case cfg.OverflowPolicy != old.OverflowPolicy:
+		return "OverflowPolicy"
+	case cfg.MaxOpenKeys != old.MaxOpenKeys:
+		return "MaxOpenKeys"
+	case cfg.Durability != old.Durability || cfg.WALDir != old.WALDir || cfg.WALSegmentSize != old.WALSegmentSize:
+		return "Durability"
+	case cfg.SpillDir != old.SpillDir || cfg.SpillMaxBytes != old.SpillMaxBytes:
+		return "SpillDir"
+	case cfg.MaxBatchWeight != old.MaxBatchWeight || cfg.OversizePolicy != old.OversizePolicy:
+		return "MaxBatchWeight"
+	case cfg.TargetLatency != old.TargetLatency || cfg.TargetItemLatency != old.TargetItemLatency:
+		return "TargetLatency"
+	case !slices.Equal(cfg.Lanes, old.Lanes):
+		return "Lanes"
+	case cfg.Breaker.FailureRatio != old.Breaker.FailureRatio || cfg.Breaker.Window != old.Breaker.Window ||
+		cfg.Breaker.OpenTimeout != old.Breaker.OpenTimeout || cfg.Breaker.HalfOpenBatches != old.Breaker.HalfOpenBatches:
+		return "Breaker"
+	case (cfg.MaxWorkers > 0) != (old.MaxWorkers > 0):
+		return "MaxWorkers"
+	}
+	return ""
+}
+
+// resize starts or retires workers until n of them are active. Retiring
+// workers keep their slot, and with it their id, until they have exited.
+func (c *ChanBatcherInstance[T]) resize(n int) error {
+	c.slotsMu.Lock()
+	defer c.slotsMu.Unlock()
+	active := 0
+	for _, s := range c.slots {
+		if !s.retiring {
+			active++
+		}
+	}
+	// Slots are sorted by id, retiring the highest ids keeps them dense
+	for i := len(c.slots) - 1; i >= 0 && active > n; i-- {
+		if s := c.slots[i]; !s.retiring {
+			s.retiring = true
+			close(s.retire)
+			active--
+		}
+	}
+	for ; active < n; active++ {
+		id := 0
+		for _, s := range c.slots {
+			if s.id != id {
+				break
+			}
+			id++
+		}
+		slot := &workerSlot{
+			id:     id,
+			flush:  make(chan chan struct{}),
+			retire: make(chan struct{}),
+			gone:   make(chan struct{}),
+		}
+		c.slots = slices.Insert(c.slots, id, slot)
+		// The pool has room for retiring workers as well
+		c.workers.Tune(len(c.slots))
+		c.workerWG.Add(1)
+		err := c.workers.Submit(func() {
+			defer c.workerWG.Done()
+			c.worker(slot)
+		})
+		if err != nil {
+			c.workerWG.Done()
+			c.slots = slices.Delete(c.slots, id, id+1)
+			return err
+		}
+	}
+	c.workerCount = n
+	return nil
+}
+
+// removeSlot forgets a worker that has exited
+func (c *ChanBatcherInstance[T]) removeSlot(slot *workerSlot) {
+	slot.leave()
+	c.slotsMu.Lock()
+	defer c.slotsMu.Unlock()
+	if i := slices.Index(c.slots, slot); i >= 0 {
+		c.slots = slices.Delete(c.slots, i, i+1)
+	}
+	if len(c.slots) > 0 {
+		c.workers.Tune(len(c.slots))
+	}
+}
+
+// liveSlots returns the workers that are running right now
+func (c *ChanBatcherInstance[T]) liveSlots() []*workerSlot {
+	c.slotsMu.Lock()
+	defer c.slotsMu.Unlock()
+	return slices.Clone(c.slots)
+}
+
+// retire emits what the worker buffers and processes its pending retries,
+// without taking new items, before the worker exits
+func (w *batchWorker[T]) retire(batchSize int) {
+	c := w.c
+	w.flush(batchSize, TRIGGER_FLUSH)
+	// Flush() no longer waits for this worker
+	w.slot.leave()
+	for len(w.retries) > 0 {
+		w.armRetryTimer()
+		select {
+		case <-c.ctx.Done():
+			w.abandon()
+			return
+		case <-w.retryTimer.C:
+			w.collectRetries(time.Now(), batchSize)
+			w.flush(batchSize, TRIGGER_FLUSH)
+		}
+	}
+}
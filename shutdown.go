@@ -0,0 +1,120 @@
+package batchy
+
+import (
+	"context"
+	"fmt"
+)
+
+// DrainError is returned by Shutdown when the deadline hits before every
+// accepted item has been processed
+type DrainError struct {
+	// Lost is the number of accepted items that were not confirmed processed
+	Lost int64
+	// Err is the context error that ended the drain
+	Err error
+}
+
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("batchy: shutdown interrupted, %d items lost: %v", e.Lost, e.Err)
+}
+
+func (e *DrainError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown 优雅关闭：停止接收新数据，处理完所有缓冲区和队列中的数据后返回
+func (c *ChanBatcherInstance[T]) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Step 1: Stop accepting new items, after this the queue can only shrink
+	c.closeIntake()
+
+	done := make(chan struct{})
+	go func() {
+		// Spilled and laned items have to reach the worker queues before they are drained
+		if !c.waitSpills(c.ctx.Done()) {
+			return
+		}
+		if !c.waitLanes(c.ctx.Done()) {
+			return
+		}
+		// Step 2: Ask every worker to flush its buffer and drain the queue
+		c.drainOnce.Do(func() {
+			close(c.draining)
+		})
+		c.workerWG.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// Anything not processed by now is given up on, including batches
+		// whose processor call is still running
+		if lost := c.pending.Load(); lost > 0 {
+			err = &DrainError{Lost: lost, Err: ctx.Err()}
+		}
+	}
+
+	// Step 3: Release resources, this also drops whatever is left
+	c.Stop()
+	return err
+}
+
+// closeIntake stops Add from accepting items and waits for in-flight
+// enqueue calls to finish
+func (c *ChanBatcherInstance[T]) closeIntake() {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		// Blocked senders observe closing and return, so this cannot deadlock
+		c.intakeMu.Lock()
+		c.intakeMu.Unlock()
+	})
+}
+
+// Flush 强制所有worker立即处理当前缓冲区中的数据，并等待处理完成
+func (c *ChanBatcherInstance[T]) Flush(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Items spilled before this call have to reach the queue first, Stop()
+	// gives up on the spill so this cannot outlive the batcher
+	if !c.waitSpills(ctx.Done()) {
+		return ctx.Err()
+	}
+	if !c.waitLanes(ctx.Done()) {
+		return ctx.Err()
+	}
+
+	slots := c.liveSlots()
+	replies := make([]chan struct{}, 0, len(slots))
+	for _, slot := range slots {
+		done := make(chan struct{})
+		select {
+		case slot.flush <- done:
+			replies = append(replies, done)
+		case <-slot.gone:
+			// A retiring worker has emitted its buffer
+		case <-c.closing:
+			return ErrBatcherStopped
+		case <-c.ctx.Done():
+			return ErrBatcherStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// A worker always answers a request it has received
+	for _, done := range replies {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+package batchy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSpillDirNotSet is returned when OVERFLOW_SPILL_TO_DISK is used without SpillDir
+var ErrSpillDirNotSet = errors.New("SpillDir must be set for OVERFLOW_SPILL_TO_DISK")
+
+const (
+	spillExt = ".spill"
+	// defaultSpillMaxBytes is used when SpillMaxBytes is not set
+	defaultSpillMaxBytes = 1 << 30
+)
+
+// spillMeta keeps the parts of a spilled entry that cannot be written to disk
+type spillMeta struct {
+	future   *Future
+	ctx      context.Context
+	key      any
+	walSeq   uint64
+	lane     int
+	weight   int
+	mergeKey any
+	enqueued time.Time
+}
+
+// spillBudget is the disk space SpillMaxBytes allows, shared by the spills of
+// all lanes
+type spillBudget struct {
+	max  int64
+	used atomic.Int64
+}
+
+// reserve takes n bytes from the budget, it reports false if they are not left
+func (b *spillBudget) reserve(n int64) bool {
+	for {
+		used := b.used.Load()
+		if used+n > b.max {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+n) {
+			return true
+		}
+	}
+}
+
+// release gives n bytes back to the budget
+func (b *spillBudget) release(n int64) {
+	b.used.Add(-n)
+}
+
+// spillQueue is a FIFO of entries that did not fit into the queue of one lane.
+// Items are encoded into segment files while their futures and contexts stay
+// in memory. The spill is not durable, files left behind by a previous run
+// are removed.
+type spillQueue[T any] struct {
+	codec       Codec[T]
+	dir         string
+	prefix      string // Tells the files of the lanes apart
+	budget      *spillBudget
+	segmentSize int64
+
+	mu      sync.Mutex
+	files   []string // Oldest first, the last one is being written
+	w       *os.File // Last file
+	wsize   int64    // Bytes written to w
+	bytes   int64    // Bytes in all files
+	nextID  uint64
+	meta    []spillMeta // One per record not read back yet
+	closed  bool
+	changed chan struct{} // Closed and replaced whenever an item leaves the spill
+
+	pushed atomic.Uint64 // Items written
+	popped atomic.Uint64 // Items handed to the queue or given up on
+
+	// Reader state, owned by the drain goroutine
+	notify chan struct{}
+	r      *os.File
+	br     *bufio.Reader
+}
+
+// newSpillQueues opens one spill per lane in dir, all of them drawing on the
+// same maxBytes budget
+func newSpillQueues[T any](dir string, maxBytes int64, lanes int, codec Codec[T]) ([]*spillQueue[T], error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("batchy: open spill: %w", err)
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, "*"+spillExt))
+	if err != nil {
+		return nil, fmt.Errorf("batchy: open spill: %w", err)
+	}
+	for _, name := range stale {
+		_ = os.Remove(name)
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultSpillMaxBytes
+	}
+	budget := &spillBudget{max: maxBytes}
+	queues := make([]*spillQueue[T], lanes)
+	for i := range queues {
+		queues[i] = &spillQueue[T]{
+			codec:       codec,
+			dir:         dir,
+			budget:      budget,
+			segmentSize: min(max(maxBytes/4, 4<<10), 64<<20),
+			changed:     make(chan struct{}),
+			notify:      make(chan struct{}, 1),
+		}
+		if lanes > 1 {
+			queues[i].prefix = fmt.Sprintf("lane%d-", i)
+		}
+	}
+	return queues, nil
+}
+
+// backlog is the number of items that entered the spill and have not left it
+func (s *spillQueue[T]) backlog() uint64 {
+	return s.pushed.Load() - s.popped.Load()
+}
+
+// push writes e to the spill. It reports false without writing anything when
+// the disk budget does not allow it.
+func (s *spillQueue[T]) push(e *entry[T]) (bool, error) {
+	data, err := s.codec.Encode(e.item)
+	if err != nil {
+		return false, fmt.Errorf("batchy: encode item: %w", err)
+	}
+	frame := appendFrame(nil, data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false, ErrBatcherStopped
+	}
+	size := int64(len(frame))
+	if !s.budget.reserve(size) {
+		return false, nil
+	}
+	if s.w == nil || (s.wsize > 0 && s.wsize+size > s.segmentSize) {
+		if err := s.rotate(); err != nil {
+			s.budget.release(size)
+			return false, err
+		}
+	}
+	n, err := s.w.Write(frame)
+	s.wsize += int64(n)
+	s.bytes += int64(n)
+	s.budget.release(size - int64(n))
+	if err != nil {
+		return false, fmt.Errorf("batchy: write spill: %w", err)
+	}
+	s.meta = append(s.meta, spillMeta{future: e.future, ctx: e.ctx, key: e.key, walSeq: e.walSeq, lane: e.lane, weight: e.weight, mergeKey: e.mergeKey, enqueued: e.enqueuedAt})
+	s.pushed.Add(1)
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// rotate starts a new file for writing. Caller holds mu.
+func (s *spillQueue[T]) rotate() error {
+	s.nextID++
+	path := filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", s.prefix, s.nextID, spillExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("batchy: create spill file: %w", err)
+	}
+	if s.w != nil {
+		_ = s.w.Close()
+	}
+	s.w = f
+	s.wsize = 0
+	s.files = append(s.files, path)
+	return nil
+}
+
+// pop reads the oldest spilled entry back. ok is false when the spill is
+// empty or closed; a non-nil err means the record could not be decoded and e
+// only carries the metadata. Only the drain goroutine calls pop.
+func (s *spillQueue[T]) pop() (e entry[T], ok bool, err error) {
+	s.mu.Lock()
+	if s.closed || len(s.meta) == 0 {
+		s.mu.Unlock()
+		return e, false, nil
+	}
+	m := s.meta[0]
+	s.meta[0] = spillMeta{}
+	s.meta = s.meta[1:]
+	s.mu.Unlock()
+
+	e = entry[T]{future: m.future, ctx: m.ctx, key: m.key, walSeq: m.walSeq, lane: m.lane, weight: m.weight, mergeKey: m.mergeKey, enqueuedAt: m.enqueued}
+	body, err := s.read()
+	if err != nil {
+		return e, true, err
+	}
+	e.item, err = s.codec.Decode(body)
+	if err != nil {
+		return e, true, fmt.Errorf("batchy: decode spilled item: %w", err)
+	}
+	return e, true, nil
+}
+
+// read returns the next record, moving on to the next file once the oldest
+// one is used up
+func (s *spillQueue[T]) read() ([]byte, error) {
+	for {
+		if s.r == nil {
+			s.mu.Lock()
+			if s.closed || len(s.files) == 0 {
+				s.mu.Unlock()
+				return nil, ErrBatcherStopped
+			}
+			name := s.files[0]
+			s.mu.Unlock()
+			f, err := os.Open(name)
+			if err != nil {
+				return nil, fmt.Errorf("batchy: open spill file: %w", err)
+			}
+			s.r = f
+			s.br = bufio.NewReader(f)
+		}
+
+		var header [recordHeader]byte
+		_, err := io.ReadFull(s.br, header[:])
+		if err == io.EOF {
+			// Items are counted after their record is written, so a file
+			// only runs dry once it is no longer written to
+			s.mu.Lock()
+			if len(s.files) > 1 {
+				_ = s.r.Close()
+				s.r, s.br = nil, nil
+				s.removeOldest()
+			}
+			s.mu.Unlock()
+			if s.r != nil {
+				return nil, fmt.Errorf("batchy: spill file ended early")
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("batchy: read spill: %w", err)
+		}
+		body := make([]byte, binary.LittleEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(s.br, body); err != nil {
+			return nil, fmt.Errorf("batchy: read spill: %w", err)
+		}
+		if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(header[4:]) {
+			return nil, fmt.Errorf("batchy: spill record checksum mismatch")
+		}
+		return body, nil
+	}
+}
+
+// removeOldest deletes the oldest file. Caller holds mu.
+func (s *spillQueue[T]) removeOldest() {
+	if info, err := os.Stat(s.files[0]); err == nil {
+		s.bytes -= info.Size()
+		s.budget.release(info.Size())
+	}
+	_ = os.Remove(s.files[0])
+	s.files = s.files[1:]
+}
+
+// done marks a popped entry as having left the spill. Once everything has
+// been read back the files are reset so their space is reclaimed.
+func (s *spillQueue[T]) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.popped.Add(1)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	if len(s.meta) > 0 || s.closed || s.r == nil {
+		return
+	}
+	_ = s.r.Close()
+	s.r, s.br = nil, nil
+	for len(s.files) > 1 {
+		s.removeOldest()
+	}
+	if err := s.w.Truncate(0); err == nil {
+		if _, err := s.w.Seek(0, io.SeekStart); err == nil {
+			s.budget.release(s.bytes)
+			s.wsize = 0
+			s.bytes = 0
+		}
+	}
+}
+
+// watch returns a channel that is closed once an item leaves the spill
+func (s *spillQueue[T]) watch() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.changed
+}
+
+// wait blocks until at least target items have left the spill
+func (s *spillQueue[T]) wait(target uint64, stop <-chan struct{}) bool {
+	for {
+		s.mu.Lock()
+		if s.popped.Load() >= target {
+			s.mu.Unlock()
+			return true
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// close removes the spill files and returns the metadata of the entries that
+// were never read back
+func (s *spillQueue[T]) close() []spillMeta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.changed)
+	s.changed = make(chan struct{})
+	if s.w != nil {
+		_ = s.w.Close()
+	}
+	for _, name := range s.files {
+		_ = os.Remove(name)
+	}
+	s.files = nil
+	s.budget.release(s.bytes)
+	s.bytes = 0
+	lost := s.meta
+	s.meta = nil
+	s.popped.Add(uint64(len(lost)))
+	return lost
+}
+
+// drainSpill moves the entries of spill s back into their lane as workers
+// make room
+func (c *ChanBatcherInstance[T]) drainSpill(s *spillQueue[T]) {
+	for {
+		select {
+		case <-s.notify:
+		case <-c.ctx.Done():
+			return
+		}
+		for {
+			e, ok, err := s.pop()
+			if !ok {
+				break
+			}
+			if err != nil {
+				// The item is gone, report it like a failed batch would
+				if e.future != nil {
+					e.future.resolve(err)
+				}
+				c.ackEntries([]entry[T]{e})
+				c.pending.Add(-1)
+				c.stats.failed.Add(1)
+				s.done()
+				continue
+			}
+			select {
+			case c.queueFor(&e) <- e:
+				s.done()
+			case <-c.ctx.Done():
+				c.fail([]entry[T]{e}, ErrBatcherStopped)
+				s.done()
+				return
+			}
+		}
+	}
+}
+
+// closeSpill drops whatever is still spilled once the batcher is stopped
+func (c *ChanBatcherInstance[T]) closeSpill() {
+	for _, s := range c.spills {
+		lost := s.close()
+		for _, m := range lost {
+			if m.future != nil {
+				m.future.resolve(ErrBatcherStopped)
+			}
+		}
+		c.pending.Add(-int64(len(lost)))
+		c.stats.dropped.Add(uint64(len(lost)))
+	}
+}
+
+// spilled returns the number of items in the spills of all lanes
+func (c *ChanBatcherInstance[T]) spilled() uint64 {
+	var n uint64
+	for _, s := range c.spills {
+		n += s.backlog()
+	}
+	return n
+}
+
+// waitSpills blocks until every item spilled before the call has left its spill
+func (c *ChanBatcherInstance[T]) waitSpills(stop <-chan struct{}) bool {
+	targets := make([]uint64, len(c.spills))
+	for i, s := range c.spills {
+		targets[i] = s.pushed.Load()
+	}
+	for i, s := range c.spills {
+		if !s.wait(targets[i], stop) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package batchy
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FlushTrigger identifies why a worker emitted a batch
+type FlushTrigger int
+
+const (
+	// TRIGGER_SIZE the buffer reached the current batch size
+	TRIGGER_SIZE FlushTrigger = iota
+	// TRIGGER_TIMEOUT the worker's flush timer fired
+	TRIGGER_TIMEOUT
+	// TRIGGER_ADAPTIVE the adaptive threshold elapsed with DynamicBatching enabled
+	TRIGGER_ADAPTIVE
+	// TRIGGER_FLUSH Flush() was called
+	TRIGGER_FLUSH
+	// TRIGGER_SHUTDOWN Shutdown() drained the worker
+	TRIGGER_SHUTDOWN
+	// TRIGGER_KEY_LIMIT a keyed worker hit MaxOpenKeys and emitted its oldest key
+	TRIGGER_KEY_LIMIT
+	// TRIGGER_WEIGHT the buffer reached MaxBatchWeight or the next item would not fit
+	TRIGGER_WEIGHT
+
+	numFlushTriggers
+)
+
+func (t FlushTrigger) String() string {
+	switch t {
+	case TRIGGER_SIZE:
+		return "size"
+	case TRIGGER_TIMEOUT:
+		return "timeout"
+	case TRIGGER_ADAPTIVE:
+		return "adaptive"
+	case TRIGGER_FLUSH:
+		return "flush"
+	case TRIGGER_SHUTDOWN:
+		return "shutdown"
+	case TRIGGER_KEY_LIMIT:
+		return "key_limit"
+	case TRIGGER_WEIGHT:
+		return "weight"
+	default:
+		return "unknown"
+	}
+}
+
+// Stats is a point-in-time snapshot of a batcher's runtime state
+type Stats struct {
+	// QueueLength 队列中等待worker接收的数据量
+	QueueLength int
+	// QueueCapacity 队列容量
+	QueueCapacity int
+	// Spilled 溢出到磁盘、尚未读回队列的数据量
+	Spilled int
+	// Lanes 各优先级通道中等待的数据量，未配置Lanes时为nil
+	Lanes []int
+	// Pending 已接收但尚未得出最终结果的数据量（队列、缓冲区、处理中、等待重试）
+	Pending int64
+	// Added 累计接收的数据量
+	Added uint64
+	// Processed 累计处理成功的数据量
+	Processed uint64
+	// Failed 累计最终处理失败的数据量（不含重试中的数据）
+	Failed uint64
+	// Dropped 累计未经处理即被丢弃的数据量
+	Dropped uint64
+	// Retried 累计安排重试的次数
+	Retried uint64
+	// Coalesced 累计被合并到同key数据中的数据量
+	Coalesced uint64
+	// TimedOut 累计处理器调用超过ProcessTimeout的批次中的数据量，在超时时计入
+	TimedOut uint64
+	// Breaker 熔断器状态，未启用时为BREAKER_CLOSED
+	Breaker BreakerState
+	// Batches 按触发原因统计的累计批次数
+	Batches map[FlushTrigger]uint64
+	// InFlightBatches 正在执行处理器的批次数
+	InFlightBatches int
+	// AbandonedBatches 超时后被放弃、但仍在后台运行的处理器调用数
+	AbandonedBatches int
+	// CurrentBatchSize 当前（动态）批次大小
+	CurrentBatchSize int
+	// FlushInterval 当前批次超时，设置延迟目标时随AIMD调整
+	FlushInterval time.Duration
+	// LiveWorkers 存活的worker数量
+	LiveWorkers int
+	// ProcessLatencyP50 最近批次处理器耗时的P50
+	ProcessLatencyP50 time.Duration
+	// ProcessLatencyP90 最近批次处理器耗时的P90
+	ProcessLatencyP90 time.Duration
+	// ProcessLatencyP99 最近批次处理器耗时的P99
+	ProcessLatencyP99 time.Duration
+}
+
+// latencySamples bounds the window used for latency percentiles
+const latencySamples = 1024
+
+// batcherStats holds the counters behind Stats, updated lock-free on the hot path
+type batcherStats struct {
+	added     atomic.Uint64
+	processed atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+	retried   atomic.Uint64
+	coalesced atomic.Uint64
+	batches   [numFlushTriggers]atomic.Uint64
+	inFlight  atomic.Int64
+	workers   atomic.Int64
+	busy      atomic.Int64 // Total processor time in nanoseconds
+	timedOut  atomic.Uint64
+	abandoned atomic.Int64 // Processor calls given up on that are still running
+
+	latencyMu sync.Mutex
+	latency   [latencySamples]time.Duration // Ring buffer of recent processor durations
+	latencyN  int                           // Total samples recorded
+}
+
+func (s *batcherStats) observeLatency(d time.Duration) {
+	s.latencyMu.Lock()
+	s.latency[s.latencyN%latencySamples] = d
+	s.latencyN++
+	s.latencyMu.Unlock()
+}
+
+// busyTime is the time workers have spent in the processor so far
+func (s *batcherStats) busyTime() time.Duration {
+	return time.Duration(s.busy.Load())
+}
+
+// latencyPercentiles returns p50, p90 and p99 of the recorded window
+func (s *batcherStats) latencyPercentiles() (p50, p90, p99 time.Duration) {
+	s.latencyMu.Lock()
+	n := min(s.latencyN, latencySamples)
+	window := slices.Clone(s.latency[:n])
+	s.latencyMu.Unlock()
+
+	if n == 0 {
+		return 0, 0, 0
+	}
+	slices.Sort(window)
+	at := func(q float64) time.Duration {
+		return window[int(q*float64(n-1))]
+	}
+	return at(0.5), at(0.9), at(0.99)
+}
+
+// Stats 返回批处理器运行时统计信息快照
+func (c *ChanBatcherInstance[T]) Stats() Stats {
+	s := &c.stats
+	queueLen, queueCap := c.queueDepth()
+	st := Stats{
+		QueueLength:      queueLen,
+		QueueCapacity:    queueCap,
+		Pending:          c.pending.Load(),
+		Added:            s.added.Load(),
+		Processed:        s.processed.Load(),
+		Failed:           s.failed.Load(),
+		Dropped:          s.dropped.Load(),
+		Retried:          s.retried.Load(),
+		Coalesced:        s.coalesced.Load(),
+		TimedOut:         s.timedOut.Load(),
+		Batches:          make(map[FlushTrigger]uint64, numFlushTriggers),
+		InFlightBatches:  int(s.inFlight.Load()),
+		AbandonedBatches: int(s.abandoned.Load()),
+		CurrentBatchSize: c.calculateDynamicBatchSize(),
+		FlushInterval:    c.limits.Load().timeout,
+		LiveWorkers:      int(s.workers.Load()),
+	}
+	if c.spills != nil {
+		st.Spilled = int(c.spilled())
+	}
+	if c.latency != nil {
+		st.FlushInterval = c.latency.scale(st.FlushInterval)
+	}
+	if c.breaker != nil {
+		st.Breaker = BreakerState(c.breaker.state.Load())
+	}
+	if c.lanes != nil {
+		st.Lanes = make([]int, len(c.lanes.queues))
+		for i, q := range c.lanes.queues {
+			st.Lanes[i] = len(q)
+		}
+	}
+	for t := FlushTrigger(0); t < numFlushTriggers; t++ {
+		st.Batches[t] = s.batches[t].Load()
+	}
+	st.ProcessLatencyP50, st.ProcessLatencyP90, st.ProcessLatencyP99 = s.latencyPercentiles()
+	return st
+}
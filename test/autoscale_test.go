@@ -0,0 +1,137 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// TestAutoscaleUpAndDown 验证队列积压时增加worker，空闲后逐步移除
+func TestAutoscaleUpAndDown(t *testing.T) {
+	var mu sync.Mutex
+	var events [][2]int
+	var processed atomic.Int64
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		time.Sleep(5 * time.Millisecond)
+		processed.Add(int64(len(items)))
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:     10,
+		QueueSize:     100,
+		Timeout:       10 * time.Millisecond,
+		MinWorkers:    1,
+		MaxWorkers:    4,
+		ScaleInterval: 10 * time.Millisecond,
+		ScaleDownIdle: 50 * time.Millisecond,
+		OnScale: func(from, to int) {
+			mu.Lock()
+			events = append(events, [2]int{from, to})
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+	waitLiveWorkers(t, b, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20000; i++ {
+			_ = b.Add(i)
+		}
+	}()
+	waitLiveWorkers(t, b, 4)
+	if got := b.Config().PoolSize; got != 4 {
+		t.Errorf("Config未反映当前worker数量: %d", got)
+	}
+	<-done
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+	if got := processed.Load(); got != 20000 {
+		t.Errorf("处理数量不匹配: 预期 20000, 实际 %d", got)
+	}
+
+	// 空闲后每个ScaleDownIdle移除一个worker，直到MinWorkers
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Stats().LiveWorkers != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if live := b.Stats().LiveWorkers; live != 1 {
+		t.Fatalf("空闲后worker数量期望 1, 实际 %d", live)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, e := range events {
+		if e[1] < 1 || e[1] > 4 {
+			t.Errorf("worker数量超出范围: %v", events)
+		}
+		if e[1] < e[0] && e[0]-e[1] != 1 {
+			t.Errorf("缩容应每次移除一个worker: %v", events)
+		}
+	}
+	if last := events[len(events)-1]; last != [2]int{2, 1} {
+		t.Errorf("最后一次变化期望 2->1, 实际 %v", events)
+	}
+}
+
+// TestAutoscaleConfig 验证自动扩缩容的参数校验和运行时调整
+func TestAutoscaleConfig(t *testing.T) {
+	process := func(items []int) []error { return nil }
+	_, err := batcher.NewChanBatcher(process, batcher.BatchConfig{
+		BatchSize:  10,
+		Timeout:    time.Second,
+		MinWorkers: 4,
+		MaxWorkers: 2,
+	})
+	if !errors.Is(err, batcher.ErrInvalidWorkerRange) {
+		t.Errorf("期望 ErrInvalidWorkerRange, 实际 %v", err)
+	}
+	_, err = batcher.NewChanBatcher(process, batcher.BatchConfig{
+		BatchSize:        10,
+		Timeout:          time.Second,
+		MaxWorkers:       2,
+		SchedulingPolicy: batcher.ORDERED_SEQUENTIAL,
+	})
+	if !errors.Is(err, batcher.ErrAutoscaleUnsupported) {
+		t.Errorf("期望 ErrAutoscaleUnsupported, 实际 %v", err)
+	}
+
+	// 未设置PoolSize时以MinWorkers启动
+	b, err := batcher.NewChanBatcher(process, batcher.BatchConfig{
+		BatchSize:     10,
+		Timeout:       time.Second,
+		MinWorkers:    2,
+		MaxWorkers:    8,
+		ScaleDownIdle: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+	waitLiveWorkers(t, b, 2)
+
+	cfg := b.Config()
+	cfg.MinWorkers = 3
+	if err := b.Reconfigure(cfg); err != nil {
+		t.Fatalf("Reconfigure失败: %v", err)
+	}
+	waitLiveWorkers(t, b, 3)
+	if got := b.Config().PoolSize; got != 3 {
+		t.Errorf("PoolSize应被限制在MinWorkers以上, 实际 %d", got)
+	}
+
+	cfg = b.Config()
+	cfg.MaxWorkers = 0
+	if err := b.Reconfigure(cfg); !errors.Is(err, batcher.ErrImmutableConfig) {
+		t.Errorf("关闭自动扩缩容期望 ErrImmutableConfig, 实际 %v", err)
+	}
+}
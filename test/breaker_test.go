@@ -0,0 +1,180 @@
+package test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// breakerDownstream 模拟可切换健康状态的下游
+type breakerDownstream struct {
+	healthy atomic.Bool
+	calls   atomic.Int32
+}
+
+func (d *breakerDownstream) process(items []int) []error {
+	d.calls.Add(1)
+	if d.healthy.Load() {
+		return nil
+	}
+	errs := make([]error, len(items))
+	for i := range errs {
+		errs[i] = errors.New("downstream unavailable")
+	}
+	return errs
+}
+
+// tripBreaker 连续提交失败批次直到熔断器断开
+func tripBreaker(t *testing.T, b batcher.Batcher[int]) {
+	t.Helper()
+	for i := 0; i < 3; i++ {
+		if err := b.AddAsync(i).Wait(); err == nil {
+			t.Fatal("下游不可用时期望失败")
+		}
+	}
+	if st := b.Stats().Breaker; st != batcher.BREAKER_OPEN {
+		t.Fatalf("期望熔断器断开, 实际 %v", st)
+	}
+}
+
+// TestBreakerHoldsAndRecovers 验证熔断期间数据被保留，试探成功后恢复处理
+func TestBreakerHoldsAndRecovers(t *testing.T) {
+	var mu sync.Mutex
+	var changes []string
+	d := &breakerDownstream{}
+	b, err := batcher.NewChanBatcher(d.process, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		QueueSize: 10,
+		Timeout:   10 * time.Millisecond,
+		Breaker: batcher.BreakerConfig{
+			FailureRatio: 0.5,
+			Window:       3,
+			OpenTimeout:  200 * time.Millisecond,
+			OnStateChange: func(from, to batcher.BreakerState) {
+				mu.Lock()
+				changes = append(changes, from.String()+"->"+to.String())
+				mu.Unlock()
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	tripBreaker(t, b)
+	calls := d.calls.Load()
+	held := []*batcher.Future{b.AddAsync(10), b.AddAsync(11)}
+	time.Sleep(50 * time.Millisecond)
+	if got := d.calls.Load(); got != calls {
+		t.Errorf("熔断期间不应调用处理器: %d 次", got-calls)
+	}
+
+	d.healthy.Store(true)
+	for i, f := range held {
+		select {
+		case <-f.Done():
+			if err := f.Wait(); err != nil {
+				t.Errorf("保留的数据 %d 期望成功, 实际 %v", i, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("熔断器未恢复")
+		}
+	}
+	if st := b.Stats().Breaker; st != batcher.BREAKER_CLOSED {
+		t.Errorf("期望熔断器闭合, 实际 %v", st)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"closed->open", "open->half_open", "half_open->closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("状态变化不正确: %v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("状态变化 %d 期望 %s, 实际 %s", i, want[i], changes[i])
+		}
+	}
+}
+
+// TestBreakerFallback 验证熔断期间批次交给备用处理器
+func TestBreakerFallback(t *testing.T) {
+	d := &breakerDownstream{}
+	var fallback atomic.Int32
+	b, err := batcher.NewChanBatcher(d.process, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		Timeout:   10 * time.Millisecond,
+		Breaker:   batcher.BreakerConfig{FailureRatio: 1, Window: 3, OpenTimeout: time.Hour},
+	}, batcher.WithFallback(func(items []int) []error {
+		fallback.Add(int32(len(items)))
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	tripBreaker(t, b)
+	for i := 0; i < 5; i++ {
+		if err := b.AddAsync(i).Wait(); err != nil {
+			t.Errorf("备用处理器期望成功, 实际 %v", err)
+		}
+	}
+	if got := fallback.Load(); got != 5 {
+		t.Errorf("备用处理器处理数量不正确: %d", got)
+	}
+	if got := d.calls.Load(); got != 3 {
+		t.Errorf("熔断期间不应调用处理器: 共 %d 次", got)
+	}
+}
+
+// TestBreakerBackpressure 验证无备用处理器时熔断导致队列写满
+func TestBreakerBackpressure(t *testing.T) {
+	d := &breakerDownstream{}
+	b, err := batcher.NewChanBatcher(d.process, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		QueueSize: 4,
+		Timeout:   10 * time.Millisecond,
+		Breaker:   batcher.BreakerConfig{FailureRatio: 0.5, Window: 3, OpenTimeout: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	tripBreaker(t, b)
+	accepted := 0
+	for i := 0; i < 100 && b.TryAdd(i); i++ {
+		accepted++
+	}
+	if accepted == 100 {
+		t.Fatal("熔断期间队列未写满")
+	}
+
+	// 被保留的批次在worker退出时得出结果
+	b.Stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Stats().Pending != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if pending := b.Stats().Pending; pending != 0 {
+		t.Errorf("Stop后仍有未解析的数据: %d", pending)
+	}
+
+	_, err = batcher.NewChanBatcher(d.process, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		Timeout:   time.Second,
+		Breaker:   batcher.BreakerConfig{FailureRatio: 1.5},
+	})
+	if !errors.Is(err, batcher.ErrInvalidFailureRatio) {
+		t.Errorf("期望 ErrInvalidFailureRatio, 实际 %v", err)
+	}
+}
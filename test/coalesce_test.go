@@ -0,0 +1,131 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+type counterUpdate struct {
+	Key   string
+	Value int
+}
+
+// newCoalescingBatcher 创建单worker的合并批处理器，记录每个批次
+func newCoalescingBatcher(t *testing.T, merge func(old, new counterUpdate) counterUpdate, fail error) (batcher.Batcher[counterUpdate], func() [][]counterUpdate) {
+	t.Helper()
+	var mu sync.Mutex
+	var batches [][]counterUpdate
+	b, err := batcher.NewChanBatcher(func(items []counterUpdate) []error {
+		mu.Lock()
+		batches = append(batches, append([]counterUpdate(nil), items...))
+		mu.Unlock()
+		if fail == nil {
+			return nil
+		}
+		errs := make([]error, len(items))
+		for i := range errs {
+			errs[i] = fail
+		}
+		return errs
+	}, batcher.BatchConfig{
+		BatchSize: 100,
+		PoolSize:  1,
+		QueueSize: 1000,
+		Timeout:   time.Hour,
+	}, batcher.WithCoalescing(func(u counterUpdate) string { return u.Key }, merge))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	t.Cleanup(b.Stop)
+	return b, func() [][]counterUpdate {
+		if err := b.Flush(context.Background()); err != nil {
+			t.Fatalf("Flush失败: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+// TestCoalescingKeepsLatest 验证同key数据只保留最新值，且每个Future都得到结果
+func TestCoalescingKeepsLatest(t *testing.T) {
+	b, batches := newCoalescingBatcher(t, nil, nil)
+
+	var futures []*batcher.Future
+	for i := 0; i < 30; i++ {
+		key := []string{"a", "b", "c"}[i%3]
+		futures = append(futures, b.AddAsync(counterUpdate{Key: key, Value: i}))
+	}
+
+	got := batches()
+	if len(got) != 1 {
+		t.Fatalf("期望1个批次, 实际 %d", len(got))
+	}
+	want := []counterUpdate{{"a", 27}, {"b", 28}, {"c", 29}}
+	if len(got[0]) != len(want) {
+		t.Fatalf("批次内容不正确: %v", got[0])
+	}
+	for i := range want {
+		if got[0][i] != want[i] {
+			t.Errorf("位置 %d 期望 %v, 实际 %v", i, want[i], got[0][i])
+		}
+	}
+	for i, f := range futures {
+		if err := f.Wait(); err != nil {
+			t.Errorf("Future %d 期望成功, 实际 %v", i, err)
+		}
+	}
+	st := b.Stats()
+	if st.Coalesced != 27 || st.Processed != 30 || st.Pending != 0 {
+		t.Errorf("统计不正确: Coalesced=%d Processed=%d Pending=%d", st.Coalesced, st.Processed, st.Pending)
+	}
+}
+
+// TestCoalescingCustomMerge 验证自定义合并函数
+func TestCoalescingCustomMerge(t *testing.T) {
+	b, batches := newCoalescingBatcher(t, func(old, new counterUpdate) counterUpdate {
+		old.Value += new.Value
+		return old
+	}, nil)
+
+	for i := 1; i <= 10; i++ {
+		_ = b.Add(counterUpdate{Key: "hits", Value: i})
+	}
+	_ = b.Add(counterUpdate{Key: "misses", Value: 1})
+
+	got := batches()
+	if len(got) != 1 || len(got[0]) != 2 {
+		t.Fatalf("批次内容不正确: %v", got)
+	}
+	if got[0][0] != (counterUpdate{"hits", 55}) || got[0][1] != (counterUpdate{"misses", 1}) {
+		t.Errorf("合并结果不正确: %v", got[0])
+	}
+}
+
+// TestCoalescingFailureReachesAllCallers 验证合并后的数据失败时所有调用方都收到错误
+func TestCoalescingFailureReachesAllCallers(t *testing.T) {
+	boom := errors.New("boom")
+	b, batches := newCoalescingBatcher(t, nil, boom)
+
+	var futures []*batcher.Future
+	for i := 0; i < 5; i++ {
+		futures = append(futures, b.AddAsync(counterUpdate{Key: "k", Value: i}))
+	}
+
+	if got := batches(); len(got) != 1 || len(got[0]) != 1 {
+		t.Fatalf("批次内容不正确: %v", got)
+	}
+	for i, f := range futures {
+		if err := f.Wait(); !errors.Is(err, boom) {
+			t.Errorf("Future %d 期望 boom, 实际 %v", i, err)
+		}
+	}
+	if st := b.Stats(); st.Failed != 5 {
+		t.Errorf("失败数量不正确: %d", st.Failed)
+	}
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// waitCtx 阻塞到ctx结束，为每条数据返回ctx的错误
+func waitCtx(ctx context.Context, batch batcher.Batch[int]) []error {
+	<-ctx.Done()
+	errs := make([]error, len(batch.Items))
+	for i := range errs {
+		errs[i] = ctx.Err()
+	}
+	return errs
+}
+
+// TestContextProcessorBatchMetadata 验证Batch携带的批次信息
+func TestContextProcessorBatchMetadata(t *testing.T) {
+	var mu sync.Mutex
+	var batches []batcher.Batch[int]
+	b, err := batcher.NewChanBatcherContext(func(ctx context.Context, batch batcher.Batch[int]) []error {
+		// Items和EnqueuedAt在返回后会被复用，需要复制
+		batch.Items = append([]int(nil), batch.Items...)
+		batch.EnqueuedAt = append([]time.Time(nil), batch.EnqueuedAt...)
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize: 3,
+		PoolSize:  1,
+		QueueSize: 1,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := b.Add(i); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 2 {
+		t.Fatalf("期望 2 个批次, 实际 %d", len(batches))
+	}
+	triggers := []batcher.FlushTrigger{batcher.TRIGGER_SIZE, batcher.TRIGGER_FLUSH}
+	for i, batch := range batches {
+		if batch.Trigger != triggers[i] {
+			t.Errorf("批次 %d 触发原因期望 %v, 实际 %v", i, triggers[i], batch.Trigger)
+		}
+		if batch.WorkerID != 0 {
+			t.Errorf("批次 %d WorkerID期望 0, 实际 %d", i, batch.WorkerID)
+		}
+		if len(batch.EnqueuedAt) != len(batch.Items) {
+			t.Fatalf("批次 %d EnqueuedAt数量与Items不一致", i)
+		}
+		for _, at := range batch.EnqueuedAt {
+			if at.Before(start) || at.After(time.Now()) {
+				t.Errorf("批次 %d 入队时间不正确: %v", i, at)
+			}
+		}
+	}
+	if batches[0].ID == 0 || batches[1].ID <= batches[0].ID {
+		t.Errorf("批次ID应递增: %d, %d", batches[0].ID, batches[1].ID)
+	}
+}
+
+// TestContextProcessorCanceledByStop 验证Stop取消正在执行的处理器
+func TestContextProcessorCanceledByStop(t *testing.T) {
+	started := make(chan struct{})
+	b, err := batcher.NewChanBatcherContext(func(ctx context.Context, batch batcher.Batch[int]) []error {
+		close(started)
+		return waitCtx(ctx, batch)
+	}, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	f := b.AddAsync(1)
+	<-started
+	b.Stop()
+	select {
+	case <-f.Done():
+		if err := f.Wait(); !errors.Is(err, context.Canceled) && !errors.Is(err, batcher.ErrBatcherStopped) {
+			t.Errorf("期望处理器被取消, 实际 %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop后处理器仍在运行")
+	}
+}
+
+// TestContextProcessorTimeout 验证ProcessTimeout到期后ctx被取消
+func TestContextProcessorTimeout(t *testing.T) {
+	b, err := batcher.NewChanBatcherContext(waitCtx, batcher.BatchConfig{
+		BatchSize:      1,
+		PoolSize:       1,
+		Timeout:        time.Hour,
+		ProcessTimeout: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	start := time.Now()
+	if err := b.AddAsync(1).Wait(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望 context.DeadlineExceeded, 实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("超时未生效, 耗时 %v", elapsed)
+	}
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// deadLetterBox 收集进入死信的数据
+type deadLetterBox struct {
+	mu    sync.Mutex
+	items []int
+	errs  []error
+}
+
+func (d *deadLetterBox) DeadLetter(items []int, errs []error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.items = append(d.items, items...)
+	d.errs = append(d.errs, errs...)
+}
+
+func (d *deadLetterBox) snapshot() ([]int, []error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.items), slices.Clone(d.errs)
+}
+
+// TestDeadLetterReceivesExhaustedItems 验证重试耗尽和不可重试的数据进入死信
+func TestDeadLetterReceivesExhaustedItems(t *testing.T) {
+	processor := func(items []int) []error {
+		errs := make([]error, len(items))
+		for i, item := range items {
+			switch {
+			case item == 3:
+				errs[i] = errPermanent
+			case item == 7:
+				errs[i] = errTransient
+			}
+		}
+		return errs
+	}
+
+	box := &deadLetterBox{}
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize:        5,
+		PoolSize:         2,
+		Timeout:          10 * time.Millisecond,
+		MaxAttempts:      3,
+		RetryBackoffBase: time.Millisecond,
+		IsRetryable: func(err error) bool {
+			return errors.Is(err, errTransient)
+		},
+	}, batcher.WithDeadLetter[int](box))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		b.Add(i)
+	}
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown失败: %v", err)
+	}
+
+	items, errs := box.snapshot()
+	slices.Sort(items)
+	if !slices.Equal(items, []int{3, 7}) {
+		t.Fatalf("死信数据期望 [3 7], 实际 %v", items)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, errPermanent) && !errors.Is(err, errTransient) {
+			t.Errorf("死信错误不符合预期: %v", err)
+		}
+	}
+}
+
+// TestDeadLetterReceivesPanickedBatch 验证处理器panic时整批数据进入死信且worker继续工作
+func TestDeadLetterReceivesPanickedBatch(t *testing.T) {
+	processor := func(items []int) []error {
+		if slices.Contains(items, 13) {
+			panic("boom")
+		}
+		return nil
+	}
+
+	var mu sync.Mutex
+	var dead []int
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 4,
+		PoolSize:  1,
+		Timeout:   time.Hour,
+		// panic的批次不参与重试
+		MaxAttempts: 5,
+	}, batcher.WithDeadLetterFunc(func(items []int, errs []error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dead = append(dead, items...)
+		for _, err := range errs {
+			if !errors.Is(err, batcher.ErrProcessorPanic) {
+				t.Errorf("期望 ErrProcessorPanic, 实际 %v", err)
+			}
+		}
+	}))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	futures := make([]*batcher.Future, 8)
+	for i := range futures {
+		futures[i] = b.AddAsync(10 + i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for i, f := range futures {
+		err := f.WaitContext(ctx)
+		if i < 4 {
+			var perr *batcher.PanicError
+			if !errors.As(err, &perr) || perr.Value != "boom" {
+				t.Errorf("item %d: 期望 PanicError(boom), 实际 %v", 10+i, err)
+			}
+		} else if err != nil {
+			t.Errorf("item %d: panic后worker应继续工作, 实际 %v", 10+i, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(dead, []int{10, 11, 12, 13}) {
+		t.Errorf("死信期望整批 [10 11 12 13], 实际 %v", dead)
+	}
+}
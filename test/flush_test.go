@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// TestFlushProcessesPartialBatches 验证Flush返回时之前添加的数据都已处理完成
+func TestFlushProcessesPartialBatches(t *testing.T) {
+	var processed int64
+	processor := func(items []int) []error {
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt64(&processed, int64(len(items)))
+		return nil
+	}
+
+	// 超时时间很长，没有Flush数据永远不会被处理
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 100,
+		PoolSize:  4,
+		QueueSize: 1000,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var added int64
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 137; i++ {
+			if err := b.Add(i); err != nil {
+				t.Fatalf("添加数据失败: %v", err)
+			}
+			added++
+		}
+		if err := b.Flush(ctx); err != nil {
+			t.Fatalf("Flush失败: %v", err)
+		}
+		if got := atomic.LoadInt64(&processed); got != added {
+			t.Fatalf("第%d轮Flush后处理数量不匹配: 预期 %d, 实际 %d", round, added, got)
+		}
+	}
+}
+
+// TestFlushAfterStop 验证停止后Flush返回错误而不是阻塞
+func TestFlushAfterStop(t *testing.T) {
+	processor := func(items []int) []error {
+		return nil
+	}
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  2,
+		Timeout:   time.Second,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	b.Stop()
+
+	if err := b.Flush(context.Background()); !errors.Is(err, batcher.ErrBatcherStopped) {
+		t.Errorf("Stop后Flush期望 ErrBatcherStopped, 实际 %v", err)
+	}
+}
+
+// TestFlushRespectsContext 验证处理器阻塞时Flush按调用方context返回
+func TestFlushRespectsContext(t *testing.T) {
+	release := make(chan struct{})
+	processor := func(items []int) []error {
+		<-release
+		return nil
+	}
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+	defer close(release)
+
+	if err := b.Add(1); err != nil {
+		t.Fatalf("添加数据失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望 context.DeadlineExceeded, 实际 %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// TestAddAsyncResolvesProcessorErrors 验证Future能拿到处理器返回的逐条错误
+func TestAddAsyncResolvesProcessorErrors(t *testing.T) {
+	errOdd := errors.New("odd item rejected")
+	processor := func(items []int) []error {
+		errs := make([]error, len(items))
+		for i, item := range items {
+			if item%2 == 1 {
+				errs[i] = fmt.Errorf("item %d: %w", item, errOdd)
+			}
+		}
+		return errs
+	}
+
+	config := batcher.BatchConfig{
+		BatchSize: 4,
+		PoolSize:  2,
+		Timeout:   20 * time.Millisecond,
+	}
+	b, err := batcher.NewChanBatcher[int](processor, config)
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	futures := make([]*batcher.Future, 10)
+	for i := range futures {
+		futures[i] = b.AddAsync(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for i, f := range futures {
+		err := f.WaitContext(ctx)
+		if i%2 == 1 && !errors.Is(err, errOdd) {
+			t.Errorf("item %d: 期望错误 %v, 实际 %v", i, errOdd, err)
+		}
+		if i%2 == 0 && err != nil {
+			t.Errorf("item %d: 期望成功, 实际 %v", i, err)
+		}
+	}
+}
+
+// TestAddAsyncNilErrorSlice 验证处理器返回nil时所有Future都成功
+func TestAddAsyncNilErrorSlice(t *testing.T) {
+	processor := func(items []string) []error {
+		return nil
+	}
+
+	b, err := batcher.NewChanBatcher[string](processor, batcher.BatchConfig{
+		BatchSize: 100,
+		PoolSize:  1,
+		Timeout:   10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	f := b.AddAsync("only-item")
+	select {
+	case <-f.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("超时批次未解析Future")
+	}
+	if err := f.Wait(); err != nil {
+		t.Errorf("期望成功, 实际 %v", err)
+	}
+}
+
+// TestAddAsyncAfterStop 验证Stop后AddAsync立即返回已停止错误
+func TestAddAsyncAfterStop(t *testing.T) {
+	processor := func(items []int) []error {
+		return nil
+	}
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  1,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	pending := b.AddAsync(1)
+	b.Stop()
+
+	if err := b.AddAsync(2).Wait(); !errors.Is(err, batcher.ErrBatcherStopped) {
+		t.Errorf("Stop后期望 ErrBatcherStopped, 实际 %v", err)
+	}
+
+	// 未处理的数据也必须解析，不能让调用方永久阻塞
+	select {
+	case <-pending.Done():
+		if !errors.Is(pending.Wait(), batcher.ErrBatcherStopped) {
+			t.Errorf("未处理数据期望 ErrBatcherStopped, 实际 %v", pending.Wait())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop后未处理数据的Future未解析")
+	}
+}
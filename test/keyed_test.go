@@ -0,0 +1,288 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+type keyedRow struct {
+	Table string
+	ID    int
+}
+
+// batchRecorder 记录处理器收到的每个批次
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]keyedRow
+}
+
+func (r *batchRecorder) process(items []keyedRow) []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, append([]keyedRow(nil), items...))
+	return nil
+}
+
+func (r *batchRecorder) snapshot() [][]keyedRow {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]keyedRow(nil), r.batches...)
+}
+
+// TestKeyedBatcherSingleKeyPerBatch 验证每个批次只包含同一个key的数据
+func TestKeyedBatcherSingleKeyPerBatch(t *testing.T) {
+	rec := &batchRecorder{}
+	b, err := batcher.NewKeyedBatcher(func(r keyedRow) string { return r.Table }, rec.process, batcher.BatchConfig{
+		BatchSize: 5,
+		PoolSize:  2,
+		QueueSize: 100,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	tables := []string{"users", "orders", "events"}
+	const perTable = 23
+	for i := 0; i < perTable; i++ {
+		for _, table := range tables {
+			if err := b.Add(keyedRow{Table: table, ID: i}); err != nil {
+				t.Fatalf("添加数据失败: %v", err)
+			}
+		}
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, batch := range rec.snapshot() {
+		if len(batch) > 5 {
+			t.Errorf("批次超过BatchSize: %d", len(batch))
+		}
+		for _, row := range batch {
+			if row.Table != batch[0].Table {
+				t.Fatalf("批次中混入了不同的key: %v", batch)
+			}
+			counts[row.Table]++
+		}
+	}
+	for _, table := range tables {
+		if counts[table] != perTable {
+			t.Errorf("%s 处理数量不匹配: 预期 %d, 实际 %d", table, perTable, counts[table])
+		}
+	}
+}
+
+// TestKeyedBatcherPerKeyTimeout 验证超时从每个key的第一条数据开始计算
+func TestKeyedBatcherPerKeyTimeout(t *testing.T) {
+	rec := &batchRecorder{}
+	b, err := batcher.NewKeyedBatcher(func(r keyedRow) string { return r.Table }, rec.process, batcher.BatchConfig{
+		BatchSize: 100,
+		PoolSize:  1,
+		Timeout:   100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	start := time.Now()
+	_ = b.Add(keyedRow{Table: "early", ID: 1})
+	time.Sleep(60 * time.Millisecond)
+	_ = b.Add(keyedRow{Table: "late", ID: 2})
+
+	deadline := time.After(2 * time.Second)
+	for len(rec.snapshot()) < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("超时未处理完两个key, 已处理批次: %v", rec.snapshot())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	elapsed := time.Since(start)
+
+	batches := rec.snapshot()
+	if batches[0][0].Table != "early" || batches[1][0].Table != "late" {
+		t.Errorf("期望先处理early再处理late, 实际 %v", batches)
+	}
+	// late 在 early 之后60ms才打开，必须等待自己的超时
+	if elapsed < 140*time.Millisecond {
+		t.Errorf("late 提前被处理: %v", elapsed)
+	}
+	if got := b.Stats().Batches[batcher.TRIGGER_TIMEOUT]; got != 2 {
+		t.Errorf("超时批次数不匹配: 预期 2, 实际 %d", got)
+	}
+}
+
+// TestKeyedBatcherMaxOpenKeys 验证超过MaxOpenKeys时最早的key被立即处理
+func TestKeyedBatcherMaxOpenKeys(t *testing.T) {
+	rec := &batchRecorder{}
+	b, err := batcher.NewKeyedBatcher(func(r keyedRow) string { return r.Table }, rec.process, batcher.BatchConfig{
+		BatchSize:   100,
+		PoolSize:    1,
+		Timeout:     time.Hour,
+		MaxOpenKeys: 2,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	// 打开c时已有a、b两个key，最早打开的a被处理
+	for _, table := range []string{"a", "b", "a", "c"} {
+		if err := b.Add(keyedRow{Table: table}); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+
+	deadline := time.After(2 * time.Second)
+	for len(rec.snapshot()) < 1 {
+		select {
+		case <-deadline:
+			t.Fatal("打开第三个key后最早的key未被处理")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	batches := rec.snapshot()
+	if len(batches) != 1 || batches[0][0].Table != "a" || len(batches[0]) != 2 {
+		t.Errorf("期望只处理了key a的2条数据, 实际 %v", batches)
+	}
+	if got := b.Stats().Batches[batcher.TRIGGER_KEY_LIMIT]; got != 1 {
+		t.Errorf("key_limit批次数不匹配: 预期 1, 实际 %d", got)
+	}
+}
+
+// TestKeyedBatcherNilKeyFunc 验证缺少key函数时返回错误
+func TestKeyedBatcherNilKeyFunc(t *testing.T) {
+	processor := func(items []int) []error { return nil }
+	_, err := batcher.NewKeyedBatcher[string, int](nil, processor, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  1,
+		Timeout:   time.Second,
+	})
+	if !errors.Is(err, batcher.ErrKeyFuncNotSet) {
+		t.Errorf("期望 ErrKeyFuncNotSet, 实际 %v", err)
+	}
+}
+
+// TestKeyedBatcherZeroBatchSize 验证BatchSize为0时按每批一条处理，不会产生空批次
+func TestKeyedBatcherZeroBatchSize(t *testing.T) {
+	rec := &batchRecorder{}
+	b, err := batcher.NewKeyedBatcher(func(r keyedRow) string { return r.Table }, rec.process, batcher.BatchConfig{
+		BatchSize: 0,
+		PoolSize:  1,
+		Timeout:   10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	if err := b.AddAsync(keyedRow{Table: "users", ID: 1}).Wait(); err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	for _, batch := range rec.snapshot() {
+		if len(batch) != 1 {
+			t.Errorf("期望每批一条数据, 实际 %d 条", len(batch))
+		}
+	}
+}
+
+// TestKeyedBatcherRoutesByKey 验证多个worker时同一key只在一个worker中缓冲，批次大小对整个批处理器生效
+func TestKeyedBatcherRoutesByKey(t *testing.T) {
+	rec := &batchRecorder{}
+	b, err := batcher.NewKeyedBatcher(func(r keyedRow) string { return r.Table }, rec.process, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  4,
+		QueueSize: 100,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	for i := 0; i < 10; i++ {
+		if err := b.Add(keyedRow{Table: "users", ID: i}); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+	deadline := time.After(2 * time.Second)
+	for len(rec.snapshot()) < 1 {
+		select {
+		case <-deadline:
+			t.Fatal("同一key凑满BatchSize后未被处理")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if batches := rec.snapshot(); len(batches) != 1 || len(batches[0]) != 10 {
+		t.Errorf("期望一个包含10条数据的批次, 实际 %v", batches)
+	}
+	cfg := b.Config()
+	cfg.PoolSize = 2
+	if err := b.Reconfigure(cfg); !errors.Is(err, batcher.ErrImmutableConfig) {
+		t.Errorf("修改PoolSize期望 ErrImmutableConfig, 实际 %v", err)
+	}
+}
+
+// TestKeyedBatcherMaxOpenKeysAcrossWorkers 验证MaxOpenKeys限制所有worker同时缓冲的key数量
+func TestKeyedBatcherMaxOpenKeysAcrossWorkers(t *testing.T) {
+	rec := &batchRecorder{}
+	b, err := batcher.NewKeyedBatcher(func(r keyedRow) string { return r.Table }, rec.process, batcher.BatchConfig{
+		BatchSize:   100,
+		PoolSize:    2,
+		QueueSize:   100,
+		Timeout:     time.Hour,
+		MaxOpenKeys: 2,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	// 逐个打开8个key，从第3个起每打开一个都要先处理一个key
+	for i := 0; i < 8; i++ {
+		if err := b.Add(keyedRow{Table: fmt.Sprintf("t%d", i), ID: i}); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+		for b.Stats().QueueLength > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := b.Stats().Batches[batcher.TRIGGER_KEY_LIMIT]; got != 6 {
+		t.Errorf("key_limit批次数不匹配: 预期 6, 实际 %d", got)
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+	total := 0
+	for _, batch := range rec.snapshot() {
+		total += len(batch)
+	}
+	if total != 8 {
+		t.Errorf("处理数量不匹配: 预期 8, 实际 %d", total)
+	}
+}
+
+// TestKeyedBatcherRejectsAutoscale 验证按key路由的批处理器不支持自动扩缩容
+func TestKeyedBatcherRejectsAutoscale(t *testing.T) {
+	rec := &batchRecorder{}
+	_, err := batcher.NewKeyedBatcher(func(r keyedRow) string { return r.Table }, rec.process, batcher.BatchConfig{
+		BatchSize:  10,
+		PoolSize:   1,
+		Timeout:    time.Second,
+		MaxWorkers: 4,
+	})
+	if !errors.Is(err, batcher.ErrAutoscaleUnsupported) {
+		t.Errorf("期望 ErrAutoscaleUnsupported, 实际 %v", err)
+	}
+}
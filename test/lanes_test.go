@@ -0,0 +1,175 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+type laneEvent struct {
+	Audit bool
+	ID    int
+}
+
+// newLaneBatcher 创建带优先级通道、处理器被阻塞的批处理器，第一条数据占住处理器，后续数据都在通道中等待
+func newLaneBatcher(t *testing.T, lanes []batcher.LaneConfig) *blockedBatcher[laneEvent] {
+	t.Helper()
+	b := newBlockedBatcher[laneEvent](t, batcher.BatchConfig{QueueSize: 200, Lanes: lanes})
+	b.occupy(t, laneEvent{ID: -1})
+	return b
+}
+
+// TestLanesHighPriorityOvertakes 验证高优先级数据不会排在大量低优先级数据之后
+func TestLanesHighPriorityOvertakes(t *testing.T) {
+	b := newLaneBatcher(t, []batcher.LaneConfig{
+		{Weight: 1, QueueSize: 200},
+		{Weight: 10, QueueSize: 10},
+	})
+
+	for i := 0; i < 100; i++ {
+		if err := b.Add(laneEvent{ID: i}); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if err := b.AddWithPriority(laneEvent{Audit: true, ID: i}, 1); err != nil {
+			t.Fatalf("添加高优先级数据失败: %v", err)
+		}
+	}
+	if lanes := b.Stats().Lanes; len(lanes) != 2 || lanes[1] != 5 {
+		t.Errorf("通道统计不正确: %v", lanes)
+	}
+
+	order := b.drain(t)[1:]
+	if len(order) != 105 {
+		t.Fatalf("处理数量不匹配: 预期 105, 实际 %d", len(order))
+	}
+	// 分发协程手中最多已有一条低优先级数据
+	for i, ev := range order {
+		if ev.Audit && i >= 8 {
+			t.Errorf("高优先级数据 %d 排在第 %d 位", ev.ID, i)
+		}
+	}
+}
+
+// TestLanesLowPriorityProgresses 验证按权重调度时低优先级通道仍能得到处理
+func TestLanesLowPriorityProgresses(t *testing.T) {
+	b := newLaneBatcher(t, []batcher.LaneConfig{
+		{Weight: 1},
+		{Weight: 3},
+	})
+
+	for i := 0; i < 100; i++ {
+		_ = b.Add(laneEvent{ID: i})
+		_ = b.AddWithPriority(laneEvent{Audit: true, ID: i}, 1)
+	}
+
+	order := b.drain(t)[1:]
+	low := 0
+	for _, ev := range order[:40] {
+		if !ev.Audit {
+			low++
+		}
+	}
+	// 权重1:3，前40条中约有10条低优先级数据
+	if low < 6 || low > 14 {
+		t.Errorf("前40条中低优先级数据数量不符合权重: %d", low)
+	}
+}
+
+// TestLanesInvalidPriority 验证priority超出通道范围时返回错误
+func TestLanesInvalidPriority(t *testing.T) {
+	processor := func(items []int) []error { return nil }
+	b, err := batcher.NewChanBatcher(processor, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  1,
+		Timeout:   time.Second,
+		Lanes:     []batcher.LaneConfig{{}, {}},
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+	if err := b.AddWithPriority(1, 2); !errors.Is(err, batcher.ErrInvalidPriority) {
+		t.Errorf("期望 ErrInvalidPriority, 实际 %v", err)
+	}
+
+	plain, err := batcher.NewChanBatcher(processor, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  1,
+		Timeout:   time.Second,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer plain.Stop()
+	if err := plain.AddWithPriority(1, 0); err != nil {
+		t.Errorf("未配置通道时priority 0应成功, 实际 %v", err)
+	}
+	if err := plain.AddWithPriority(1, 1); !errors.Is(err, batcher.ErrInvalidPriority) {
+		t.Errorf("期望 ErrInvalidPriority, 实际 %v", err)
+	}
+}
+
+// TestLanesSpillKeepsPriority 验证低优先级通道溢出到磁盘时，高优先级数据不会排在溢出数据之后
+func TestLanesSpillKeepsPriority(t *testing.T) {
+	b := newBlockedBatcher[laneEvent](t, batcher.BatchConfig{
+		Lanes:          []batcher.LaneConfig{{Weight: 1, QueueSize: 4}, {Weight: 100, QueueSize: 4}},
+		OverflowPolicy: batcher.OVERFLOW_SPILL_TO_DISK,
+		SpillDir:       t.TempDir(),
+	})
+	b.occupy(t, laneEvent{ID: -1})
+
+	for i := 0; i < 30; i++ {
+		if err := b.Add(laneEvent{ID: i}); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+	if b.Stats().Spilled == 0 {
+		t.Fatal("低优先级通道应溢出到磁盘")
+	}
+	if err := b.AddWithPriority(laneEvent{Audit: true}, 1); err != nil {
+		t.Fatalf("添加高优先级数据失败: %v", err)
+	}
+	if waiting := b.Stats().Lanes[1]; waiting != 1 {
+		t.Errorf("高优先级数据应进入自己的通道, 通道中数据量 %d", waiting)
+	}
+
+	order := b.drain(t)[1:]
+	if len(order) != 31 {
+		t.Fatalf("处理数量不匹配: 预期 31, 实际 %d", len(order))
+	}
+	// 分发协程手中最多已有一条低优先级数据
+	for i, ev := range order {
+		if ev.Audit && i > 1 {
+			t.Errorf("高优先级数据排在第 %d 位", i)
+		}
+	}
+}
+
+// TestLanesRejectPartitioned 验证通道不能与KEY_HASH和按key分组同时使用
+func TestLanesRejectPartitioned(t *testing.T) {
+	lanes := []batcher.LaneConfig{{}, {}}
+	_, err := batcher.NewChanBatcher(func(items []int) []error { return nil }, batcher.BatchConfig{
+		BatchSize:        10,
+		PoolSize:         2,
+		Timeout:          time.Second,
+		SchedulingPolicy: batcher.KEY_HASH,
+		Lanes:            lanes,
+	}, batcher.WithPartitionKey(func(v int) int { return v }))
+	if !errors.Is(err, batcher.ErrLanesPartitioned) {
+		t.Errorf("KEY_HASH期望 ErrLanesPartitioned, 实际 %v", err)
+	}
+
+	_, err = batcher.NewKeyedBatcher(func(v int) int { return v }, func(items []int) []error { return nil }, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  2,
+		Timeout:   time.Second,
+		Lanes:     lanes,
+	})
+	if !errors.Is(err, batcher.ErrLanesPartitioned) {
+		t.Errorf("NewKeyedBatcher期望 ErrLanesPartitioned, 实际 %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// floodBatcher 连续添加total条数据后Flush
+func floodBatcher(t *testing.T, b batcher.Batcher[int], total int) {
+	t.Helper()
+	for i := 0; i < total; i++ {
+		if err := b.Add(i); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+}
+
+// TestLatencyTargetShrinksSlowBatches 验证处理器耗时超过目标时批次大小减小
+func TestLatencyTargetShrinksSlowBatches(t *testing.T) {
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		// 每条数据耗时100µs，50条即达到目标耗时
+		time.Sleep(time.Duration(len(items)) * 100 * time.Microsecond)
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:     200,
+		MinBatchSize:  10,
+		MaxBatchSize:  400,
+		PoolSize:      1,
+		QueueSize:     100,
+		Timeout:       time.Second,
+		TargetLatency: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	floodBatcher(t, b, 3000)
+	if size := b.Stats().CurrentBatchSize; size >= 100 {
+		t.Errorf("处理器过慢时批次大小应减小, 实际 %d", size)
+	}
+}
+
+// TestLatencyTargetGrowsFastBatches 验证处理器耗时低于目标时满批次逐步增大
+func TestLatencyTargetGrowsFastBatches(t *testing.T) {
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:     10,
+		MaxBatchSize:  100,
+		PoolSize:      1,
+		QueueSize:     1000,
+		Timeout:       time.Second,
+		TargetLatency: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	if size := b.Stats().CurrentBatchSize; size != 10 {
+		t.Fatalf("初始批次大小应为BatchSize, 实际 %d", size)
+	}
+	floodBatcher(t, b, 5000)
+	if size := b.Stats().CurrentBatchSize; size <= 10 {
+		t.Errorf("处理器足够快时批次大小应增大, 实际 %d", size)
+	}
+}
+
+// TestItemLatencyTargetShrinksInterval 验证端到端延迟超过目标时批次超时缩短
+func TestItemLatencyTargetShrinksInterval(t *testing.T) {
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:         100,
+		PoolSize:          1,
+		Timeout:           200 * time.Millisecond,
+		TargetItemLatency: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	if interval := b.Stats().FlushInterval; interval != 200*time.Millisecond {
+		t.Fatalf("初始批次超时应为Timeout, 实际 %v", interval)
+	}
+	// 低流量下每条数据都等到超时才处理
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		if err := b.AddAsync(i).Wait(); err != nil {
+			t.Fatalf("处理失败: %v", err)
+		}
+		t.Logf("第 %d 条数据耗时 %v", i, time.Since(start))
+	}
+	if interval := b.Stats().FlushInterval; interval > 50*time.Millisecond {
+		t.Errorf("端到端延迟超过目标时批次超时应缩短, 实际 %v", interval)
+	}
+}
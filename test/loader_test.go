@@ -0,0 +1,265 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// TestLoaderBatchesAndDeduplicates 验证并发Load合并为一次fetch且同一key只加载一次
+func TestLoaderBatchesAndDeduplicates(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var fetches [][]int
+	l, err := batcher.NewLoader(func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		fetches = append(fetches, append([]int(nil), keys...))
+		mu.Unlock()
+		<-release
+		values := make(map[int]string, len(keys))
+		for _, k := range keys {
+			values[k] = fmt.Sprintf("user-%d", k)
+		}
+		return values, nil
+	}, batcher.BatchConfig{
+		BatchSize: 100,
+		PoolSize:  1,
+		Timeout:   20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建加载器失败: %v", err)
+	}
+	defer l.Stop()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(key int) {
+			defer wg.Done()
+			v, err := l.Load(context.Background(), key)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if want := fmt.Sprintf("user-%d", key); v != want {
+				errs <- fmt.Errorf("key %d 期望 %s, 实际 %s", key, want, v)
+			}
+		}(i % 10)
+	}
+	// fetch执行期间到达的Load复用同一次fetch
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	mu.Lock()
+	if len(fetches) != 1 || len(fetches[0]) != 10 {
+		t.Errorf("期望一次fetch加载10个key, 实际 %v", fetches)
+	}
+	mu.Unlock()
+
+	// fetch返回后不缓存，再次Load会重新加载
+	if _, err := l.Load(context.Background(), 1); err != nil {
+		t.Fatalf("Load失败: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(fetches) != 2 {
+		t.Errorf("期望再次fetch, 实际 %d 次", len(fetches))
+	}
+}
+
+// TestLoaderErrors 验证缺失的key、fetch错误和调用方取消
+func TestLoaderErrors(t *testing.T) {
+	fetchErr := errors.New("database unavailable")
+	l, err := batcher.NewLoader(func(ctx context.Context, keys []string) (map[string]int, error) {
+		for _, k := range keys {
+			switch k {
+			case "broken":
+				return nil, fetchErr
+			case "slow":
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+		return map[string]int{"a": 1}, nil
+	}, batcher.BatchConfig{
+		BatchSize:   1,
+		PoolSize:    2,
+		Timeout:     time.Millisecond,
+		MaxAttempts: 3,
+	})
+	if err != nil {
+		t.Fatalf("创建加载器失败: %v", err)
+	}
+	defer l.Stop()
+
+	if v, err := l.Load(context.Background(), "a"); err != nil || v != 1 {
+		t.Errorf("期望 1, 实际 %v, %v", v, err)
+	}
+	if _, err := l.Load(context.Background(), "missing"); !errors.Is(err, batcher.ErrKeyNotFound) {
+		t.Errorf("期望 ErrKeyNotFound, 实际 %v", err)
+	}
+	if retried := l.Stats().Retried; retried != 0 {
+		t.Errorf("缺失的key不应重试, 实际重试 %d 次", retried)
+	}
+	if _, err := l.Load(context.Background(), "broken"); !errors.Is(err, fetchErr) {
+		t.Errorf("期望fetch错误, 实际 %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Load(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望 context.DeadlineExceeded, 实际 %v", err)
+	}
+
+	_, err = batcher.NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		return nil, nil
+	}, batcher.BatchConfig{
+		BatchSize:  1,
+		PoolSize:   1,
+		Timeout:    time.Second,
+		Durability: batcher.DURABILITY_SYNC,
+		WALDir:     t.TempDir(),
+	})
+	if !errors.Is(err, batcher.ErrLoaderNotPersistent) {
+		t.Errorf("期望 ErrLoaderNotPersistent, 实际 %v", err)
+	}
+}
+
+// TestLoaderQueueFullHonoursDeadline 验证队列满时Load在ctx结束后返回
+func TestLoaderQueueFullHonoursDeadline(t *testing.T) {
+	release := make(chan struct{})
+	l, err := batcher.NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		<-release
+		values := make(map[int]int, len(keys))
+		for _, k := range keys {
+			values[k] = k
+		}
+		return values, nil
+	}, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		QueueSize: 1,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建加载器失败: %v", err)
+	}
+	defer l.Stop()
+
+	// key 0 正在fetch，key 1 占满队列
+	var wg sync.WaitGroup
+	for key := 0; key < 2; key++ {
+		wg.Add(1)
+		go func(key int) {
+			defer wg.Done()
+			if v, err := l.Load(context.Background(), key); err != nil || v != key {
+				t.Errorf("key %d 期望成功, 实际 %v, %v", key, v, err)
+			}
+		}(key)
+		deadline := time.Now().Add(2 * time.Second)
+		for st := l.Stats(); st.InFlightBatches+st.QueueLength <= key; st = l.Stats() {
+			if time.Now().After(deadline) {
+				t.Fatalf("key %d 未进入队列: %+v", key, st)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := l.Load(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望 context.DeadlineExceeded, 实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("队列满时Load未在ctx结束后返回, 耗时 %v", elapsed)
+	}
+
+	close(release)
+	wg.Wait()
+}
+
+// TestLoaderJoinedWaiterOutlivesFirstCaller 验证队列满时第一个调用方离开后，加入同一key的Load仍得到结果
+func TestLoaderJoinedWaiterOutlivesFirstCaller(t *testing.T) {
+	release := make(chan struct{})
+	l, err := batcher.NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		<-release
+		values := make(map[int]int, len(keys))
+		for _, k := range keys {
+			values[k] = k
+		}
+		return values, nil
+	}, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		QueueSize: 1,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建加载器失败: %v", err)
+	}
+	defer l.Stop()
+
+	// key 0 正在fetch，key 1 占满队列
+	var wg sync.WaitGroup
+	for key := 0; key < 2; key++ {
+		wg.Add(1)
+		go func(key int) {
+			defer wg.Done()
+			if v, err := l.Load(context.Background(), key); err != nil || v != key {
+				t.Errorf("key %d 期望成功, 实际 %v, %v", key, v, err)
+			}
+		}(key)
+		deadline := time.Now().Add(2 * time.Second)
+		for st := l.Stats(); st.InFlightBatches+st.QueueLength <= key; st = l.Stats() {
+			if time.Now().After(deadline) {
+				t.Fatalf("key %d 未进入队列: %+v", key, st)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// 第一个调用方等待队列空间，另一个Load加入同一key
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := l.Load(ctx, 2)
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	joined := make(chan error, 1)
+	go func() {
+		v, err := l.Load(context.Background(), 2)
+		if err == nil && v != 2 {
+			err = fmt.Errorf("期望 2, 实际 %d", v)
+		}
+		joined <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("第一个调用方期望 context.Canceled, 实际 %v", err)
+	}
+	select {
+	case err := <-joined:
+		t.Fatalf("第一个调用方离开后加入的Load不应结束, 实际 %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-joined; err != nil {
+		t.Errorf("加入的Load期望成功, 实际 %v", err)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,181 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// blockedBatcher 处理器被阻塞的批处理器，unblock后按处理顺序记录数据
+type blockedBatcher[T any] struct {
+	batcher.Batcher[T]
+	release chan struct{}
+	once    sync.Once
+
+	mu        sync.Mutex
+	processed []T
+}
+
+// newBlockedBatcher 创建处理器被阻塞的批处理器，BatchSize和PoolSize固定为1、Timeout为1小时，config中的其他字段按原样使用
+func newBlockedBatcher[T any](t *testing.T, config batcher.BatchConfig) *blockedBatcher[T] {
+	t.Helper()
+	bb := &blockedBatcher[T]{release: make(chan struct{})}
+	config.BatchSize = 1
+	config.PoolSize = 1
+	config.Timeout = time.Hour
+	b, err := batcher.NewChanBatcher(func(items []T) []error {
+		<-bb.release
+		bb.mu.Lock()
+		bb.processed = append(bb.processed, items...)
+		bb.mu.Unlock()
+		return nil
+	}, config)
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	bb.Batcher = b
+	t.Cleanup(func() {
+		bb.unblock()
+		b.Stop()
+	})
+	return bb
+}
+
+// occupy 添加一条数据并等待它进入处理器，之后的数据都在队列中等待
+func (b *blockedBatcher[T]) occupy(t *testing.T, item T) {
+	t.Helper()
+	if err := b.Add(item); err != nil {
+		t.Fatalf("添加数据失败: %v", err)
+	}
+	for b.Stats().InFlightBatches == 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// unblock 放行处理器，可重复调用
+func (b *blockedBatcher[T]) unblock() {
+	b.once.Do(func() { close(b.release) })
+}
+
+// drain 放行处理器并Shutdown，返回按处理顺序记录的数据
+func (b *blockedBatcher[T]) drain(t *testing.T) []T {
+	t.Helper()
+	b.unblock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown失败: %v", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.processed)
+}
+
+// TestTryAddNeverBlocks 验证TryAdd在队列满时立即返回false
+func TestTryAddNeverBlocks(t *testing.T) {
+	b := newBlockedBatcher[int](t, batcher.BatchConfig{QueueSize: 2, OverflowPolicy: batcher.OVERFLOW_BLOCK})
+	b.occupy(t, -1)
+
+	if !b.TryAdd(1) || !b.TryAdd(2) {
+		t.Fatal("队列未满时TryAdd应成功")
+	}
+	start := time.Now()
+	if b.TryAdd(3) {
+		t.Error("队列满时TryAdd应返回false")
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("TryAdd发生了阻塞")
+	}
+
+	if processed := b.drain(t); !slices.Equal(processed, []int{-1, 1, 2}) {
+		t.Errorf("处理结果不符合预期: %v", processed)
+	}
+	if b.TryAdd(4) {
+		t.Error("停止后TryAdd应返回false")
+	}
+}
+
+// TestOverflowDropNewest 验证DROP_NEWEST丢弃新数据且不阻塞
+func TestOverflowDropNewest(t *testing.T) {
+	b := newBlockedBatcher[int](t, batcher.BatchConfig{QueueSize: 2, OverflowPolicy: batcher.OVERFLOW_DROP_NEWEST})
+	b.occupy(t, -1)
+
+	for i := 1; i <= 5; i++ {
+		if err := b.Add(i); err != nil {
+			t.Fatalf("DROP_NEWEST下Add不应返回错误: %v", err)
+		}
+	}
+	if err := b.AddAsync(6).Wait(); !errors.Is(err, batcher.ErrItemDropped) {
+		t.Errorf("被丢弃数据的Future期望 ErrItemDropped, 实际 %v", err)
+	}
+	if st := b.Stats(); st.Dropped != 4 {
+		t.Errorf("Dropped 期望 4, 实际 %d", st.Dropped)
+	}
+
+	if processed := b.drain(t); !slices.Equal(processed, []int{-1, 1, 2}) {
+		t.Errorf("处理结果不符合预期: %v", processed)
+	}
+}
+
+// TestOverflowDropOldest 验证DROP_OLDEST丢弃最旧的数据为新数据腾出空间
+func TestOverflowDropOldest(t *testing.T) {
+	b := newBlockedBatcher[int](t, batcher.BatchConfig{QueueSize: 2, OverflowPolicy: batcher.OVERFLOW_DROP_OLDEST})
+	b.occupy(t, -1)
+
+	oldest := b.AddAsync(1)
+	for i := 2; i <= 5; i++ {
+		if err := b.Add(i); err != nil {
+			t.Fatalf("DROP_OLDEST下Add不应返回错误: %v", err)
+		}
+	}
+	if err := oldest.Wait(); !errors.Is(err, batcher.ErrItemDropped) {
+		t.Errorf("被挤出数据的Future期望 ErrItemDropped, 实际 %v", err)
+	}
+	if !b.TryAdd(6) {
+		t.Error("DROP_OLDEST下TryAdd应通过丢弃旧数据成功")
+	}
+
+	if processed := b.drain(t); !slices.Equal(processed, []int{-1, 5, 6}) {
+		t.Errorf("处理结果不符合预期: %v", processed)
+	}
+}
+
+// TestOverflowReturnError 验证RETURN_ERROR返回ErrQueueFull
+func TestOverflowReturnError(t *testing.T) {
+	b := newBlockedBatcher[int](t, batcher.BatchConfig{QueueSize: 1, OverflowPolicy: batcher.OVERFLOW_RETURN_ERROR})
+	b.occupy(t, -1)
+
+	if err := b.Add(1); err != nil {
+		t.Fatalf("队列未满时Add应成功: %v", err)
+	}
+	if err := b.Add(2); !errors.Is(err, batcher.ErrQueueFull) {
+		t.Errorf("期望 ErrQueueFull, 实际 %v", err)
+	}
+	if err := b.AddAsync(3).Wait(); !errors.Is(err, batcher.ErrQueueFull) {
+		t.Errorf("Future期望 ErrQueueFull, 实际 %v", err)
+	}
+	if st := b.Stats(); st.Added != 2 || st.Dropped != 0 {
+		t.Errorf("被拒绝的数据不应计入: added=%d dropped=%d", st.Added, st.Dropped)
+	}
+
+	if processed := b.drain(t); !slices.Equal(processed, []int{-1, 1}) {
+		t.Errorf("处理结果不符合预期: %v", processed)
+	}
+}
+
+func TestInvalidOverflowPolicy(t *testing.T) {
+	_, err := batcher.NewChanBatcher[int](func(items []int) []error { return nil }, batcher.BatchConfig{
+		BatchSize:      1,
+		PoolSize:       1,
+		Timeout:        time.Second,
+		OverflowPolicy: batcher.OverflowPolicy(42),
+	})
+	if !errors.Is(err, batcher.ErrInvalidOverflowPolicy) {
+		t.Errorf("期望 ErrInvalidOverflowPolicy, 实际 %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// TestWorkersSurviveRepeatedPanics 验证处理器反复panic后所有worker仍然存活
+func TestWorkersSurviveRepeatedPanics(t *testing.T) {
+	var processed int64
+	processor := func(items []int) []error {
+		if items[0] < 0 {
+			panic("negative batch")
+		}
+		atomic.AddInt64(&processed, int64(len(items)))
+		return nil
+	}
+
+	var mu sync.Mutex
+	var panics []*batcher.PanicError
+	workersSeen := make(map[int]bool)
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  2,
+		QueueSize: 4,
+		Timeout:   time.Hour,
+		OnPanic: func(workerID int, err *batcher.PanicError) {
+			mu.Lock()
+			defer mu.Unlock()
+			panics = append(panics, err)
+			workersSeen[workerID] = true
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	// 远多于worker数量的panic批次
+	for i := 0; i < 20; i++ {
+		b.Add(-1)
+	}
+	for i := 0; i < 20; i++ {
+		b.Add(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := b.Flush(ctx); err != nil {
+		t.Fatalf("panic后Flush失败，worker可能已退出: %v", err)
+	}
+	if got := atomic.LoadInt64(&processed); got != 20 {
+		t.Errorf("期望处理 20 项, 实际 %d", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(panics) != 20 {
+		t.Fatalf("期望 OnPanic 调用 20 次, 实际 %d", len(panics))
+	}
+	if panics[0].Value != "negative batch" {
+		t.Errorf("panic值不符合预期: %v", panics[0].Value)
+	}
+	if !strings.Contains(string(panics[0].Stack), "TestWorkersSurviveRepeatedPanics") {
+		t.Errorf("堆栈中应包含处理器调用位置:\n%s", panics[0].Stack)
+	}
+}
+
+// TestPanickingDeadLetterSink 验证死信接收器panic不会影响worker
+func TestPanickingDeadLetterSink(t *testing.T) {
+	processor := func(items []int) []error {
+		errs := make([]error, len(items))
+		for i := range items {
+			errs[i] = errPermanent
+		}
+		return errs
+	}
+
+	var reported int64
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		Timeout:   time.Hour,
+		OnPanic: func(workerID int, err *batcher.PanicError) {
+			atomic.AddInt64(&reported, 1)
+		},
+	}, batcher.WithDeadLetterFunc(func(items []int, errs []error) {
+		panic("sink unavailable")
+	}))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	for i := 0; i < 3; i++ {
+		if err := b.AddAsync(i).Wait(); err != errPermanent {
+			t.Errorf("item %d: 期望 errPermanent, 实际 %v", i, err)
+		}
+	}
+	// 死信在Future解析之后调用，Flush保证前面的批次已全部结束
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+	if got := atomic.LoadInt64(&reported); got != 3 {
+		t.Errorf("期望 OnPanic 调用 3 次, 实际 %d", got)
+	}
+}
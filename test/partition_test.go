@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+type orderEvent struct {
+	OrderID string
+	Seq     int
+}
+
+// workerSet 通过Observer记录参与处理的worker
+type workerSet struct {
+	mu  sync.Mutex
+	ids map[int]bool
+}
+
+func (s *workerSet) ObserveBatch(info batcher.BatchInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[info.WorkerID] = true
+}
+
+// TestKeyHashPreservesPerKeyOrder 验证KEY_HASH下同一key的数据按添加顺序处理，且多个worker并行工作
+func TestKeyHashPreservesPerKeyOrder(t *testing.T) {
+	var mu sync.Mutex
+	lastSeq := make(map[string]int)
+	var outOfOrder []string
+	processor := func(items []orderEvent) []error {
+		mu.Lock()
+		for _, ev := range items {
+			if prev, ok := lastSeq[ev.OrderID]; ok && ev.Seq != prev+1 {
+				outOfOrder = append(outOfOrder, fmt.Sprintf("%s: %d -> %d", ev.OrderID, prev, ev.Seq))
+			}
+			lastSeq[ev.OrderID] = ev.Seq
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+
+	workers := &workerSet{ids: make(map[int]bool)}
+	b, err := batcher.NewChanBatcher(processor, batcher.BatchConfig{
+		BatchSize:        16,
+		PoolSize:         4,
+		Timeout:          10 * time.Millisecond,
+		SchedulingPolicy: batcher.KEY_HASH,
+		Observer:         workers,
+	}, batcher.WithPartitionKey(func(ev orderEvent) string { return ev.OrderID }))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	const orders, events = 20, 100
+	for seq := 0; seq < events; seq++ {
+		for o := 0; o < orders; o++ {
+			if err := b.Add(orderEvent{OrderID: fmt.Sprintf("order-%d", o), Seq: seq}); err != nil {
+				t.Fatalf("添加数据失败: %v", err)
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Flush(ctx); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(outOfOrder) > 0 {
+		t.Errorf("同一key的数据乱序: %v", outOfOrder)
+	}
+	for o := 0; o < orders; o++ {
+		if got := lastSeq[fmt.Sprintf("order-%d", o)]; got != events-1 {
+			t.Errorf("order-%d 未处理完: 最后序号 %d", o, got)
+		}
+	}
+	workers.mu.Lock()
+	defer workers.mu.Unlock()
+	if len(workers.ids) < 2 {
+		t.Errorf("期望多个worker并行处理, 实际只有 %d 个", len(workers.ids))
+	}
+}
+
+// TestKeyHashRequiresPartitionKey 验证KEY_HASH缺少分区key时返回错误
+func TestKeyHashRequiresPartitionKey(t *testing.T) {
+	processor := func(items []int) []error { return nil }
+	_, err := batcher.NewChanBatcher(processor, batcher.BatchConfig{
+		BatchSize:        10,
+		PoolSize:         4,
+		Timeout:          time.Second,
+		SchedulingPolicy: batcher.KEY_HASH,
+	})
+	if !errors.Is(err, batcher.ErrPartitionKeyNotSet) {
+		t.Errorf("期望 ErrPartitionKeyNotSet, 实际 %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// waitLiveWorkers 等待存活worker数量达到n
+func waitLiveWorkers(t *testing.T, b batcher.Batcher[int], n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Stats().LiveWorkers != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("存活worker数量期望 %d, 实际 %d", n, b.Stats().LiveWorkers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestReconfigurePoolSize 验证运行时增减worker数量且不丢失数据
+func TestReconfigurePoolSize(t *testing.T) {
+	var processed atomic.Int64
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		processed.Add(int64(len(items)))
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  2,
+		QueueSize: 100,
+		Timeout:   20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5000; i++ {
+			_ = b.Add(i)
+		}
+	}()
+
+	for _, size := range []int{6, 1, 4} {
+		cfg := b.Config()
+		cfg.PoolSize = size
+		if err := b.Reconfigure(cfg); err != nil {
+			t.Fatalf("Reconfigure失败: %v", err)
+		}
+		waitLiveWorkers(t, b, size)
+	}
+	if got := b.Config().PoolSize; got != 4 {
+		t.Errorf("Config未反映新的PoolSize: %d", got)
+	}
+
+	wg.Wait()
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+	if got := processed.Load(); got != 5000 {
+		t.Errorf("处理数量不匹配: 预期 5000, 实际 %d", got)
+	}
+}
+
+// TestReconfigureRetiredWorkerEmitsBuffer 验证被移除的worker处理完缓冲区中的数据
+func TestReconfigureRetiredWorkerEmitsBuffer(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		mu.Lock()
+		sizes = append(sizes, len(items))
+		mu.Unlock()
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  4,
+		QueueSize: 100,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	var futures []*batcher.Future
+	for i := 0; i < 20; i++ {
+		futures = append(futures, b.AddAsync(i))
+	}
+	// 等待数据进入各worker的缓冲区
+	for b.Stats().QueueLength > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cfg := b.Config()
+	cfg.PoolSize = 1
+	cfg.BatchSize = 50
+	if err := b.Reconfigure(cfg); err != nil {
+		t.Fatalf("Reconfigure失败: %v", err)
+	}
+	waitLiveWorkers(t, b, 1)
+	if size := b.Stats().CurrentBatchSize; size != 50 {
+		t.Errorf("批次大小期望 50, 实际 %d", size)
+	}
+
+	for i := 0; i < 100; i++ {
+		futures = append(futures, b.AddAsync(i))
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+	for i, f := range futures {
+		if err := f.Wait(); err != nil {
+			t.Fatalf("Future %d 期望成功, 实际 %v", i, err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if last := sizes[len(sizes)-1]; last > 50 {
+		t.Errorf("新批次大小未生效: %v", sizes)
+	}
+	if sizes[len(sizes)-2] != 50 {
+		t.Errorf("满批次应为50条: %v", sizes)
+	}
+}
+
+// TestReconfigureRejectsImmutableFields 验证不可在运行时修改的字段被拒绝
+func TestReconfigureRejectsImmutableFields(t *testing.T) {
+	b, err := batcher.NewChanBatcher(func(items []int) []error { return nil }, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  2,
+		QueueSize: 100,
+		Timeout:   time.Second,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	cfg := b.Config()
+	cfg.QueueSize = 1000
+	if err := b.Reconfigure(cfg); !errors.Is(err, batcher.ErrImmutableConfig) {
+		t.Errorf("期望 ErrImmutableConfig, 实际 %v", err)
+	}
+	cfg = b.Config()
+	cfg.PoolSize = 0
+	if err := b.Reconfigure(cfg); !errors.Is(err, batcher.ErrWorkerNotSet) {
+		t.Errorf("期望 ErrWorkerNotSet, 实际 %v", err)
+	}
+
+	b.Stop()
+	if err := b.Reconfigure(b.Config()); !errors.Is(err, batcher.ErrBatcherStopped) {
+		t.Errorf("期望 ErrBatcherStopped, 实际 %v", err)
+	}
+
+	keyed, err := batcher.NewChanBatcher(func(items []int) []error { return nil }, batcher.BatchConfig{
+		BatchSize:        10,
+		PoolSize:         2,
+		Timeout:          time.Second,
+		SchedulingPolicy: batcher.KEY_HASH,
+	}, batcher.WithPartitionKey(func(v int) int { return v }))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer keyed.Stop()
+	cfg = keyed.Config()
+	cfg.PoolSize = 4
+	if err := keyed.Reconfigure(cfg); !errors.Is(err, batcher.ErrImmutableConfig) {
+		t.Errorf("KEY_HASH下修改PoolSize期望 ErrImmutableConfig, 实际 %v", err)
+	}
+}
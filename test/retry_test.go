@@ -0,0 +1,288 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+var errTransient = errors.New("transient failure")
+var errPermanent = errors.New("permanent failure")
+
+// attemptRecorder 记录每条数据被处理的次数和每个批次的内容
+type attemptRecorder struct {
+	mu       sync.Mutex
+	attempts map[int]int
+	batches  [][]int
+}
+
+func newAttemptRecorder() *attemptRecorder {
+	return &attemptRecorder{attempts: make(map[int]int)}
+}
+
+func (r *attemptRecorder) record(items []int) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make([]int, len(items))
+	for i, item := range items {
+		r.attempts[item]++
+		counts[i] = r.attempts[item]
+	}
+	r.batches = append(r.batches, slices.Clone(items))
+	return counts
+}
+
+func (r *attemptRecorder) attemptsOf(item int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts[item]
+}
+
+// TestRetryOnlyFailedItems 验证只有失败的数据会被重试，直到成功
+func TestRetryOnlyFailedItems(t *testing.T) {
+	rec := newAttemptRecorder()
+	processor := func(items []int) []error {
+		counts := rec.record(items)
+		errs := make([]error, len(items))
+		for i, item := range items {
+			// 3的倍数前两次失败
+			if item%3 == 0 && counts[i] < 3 {
+				errs[i] = errTransient
+			}
+		}
+		return errs
+	}
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize:        10,
+		PoolSize:         2,
+		Timeout:          20 * time.Millisecond,
+		MaxAttempts:      3,
+		RetryBackoffBase: 5 * time.Millisecond,
+		RetryBackoffMax:  20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	futures := make([]*batcher.Future, 30)
+	for i := range futures {
+		futures[i] = b.AddAsync(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i, f := range futures {
+		if err := f.WaitContext(ctx); err != nil {
+			t.Errorf("item %d: 期望重试后成功, 实际 %v", i, err)
+		}
+		want := 1
+		if i%3 == 0 {
+			want = 3
+		}
+		if got := rec.attemptsOf(i); got != want {
+			t.Errorf("item %d: 期望处理 %d 次, 实际 %d 次", i, want, got)
+		}
+	}
+}
+
+// TestRetryClassifierAndExhaustion 验证不可重试错误立即返回，可重试错误在次数耗尽后返回
+func TestRetryClassifierAndExhaustion(t *testing.T) {
+	rec := newAttemptRecorder()
+	processor := func(items []int) []error {
+		rec.record(items)
+		errs := make([]error, len(items))
+		for i, item := range items {
+			if item == 0 {
+				errs[i] = errPermanent
+			} else {
+				errs[i] = errTransient
+			}
+		}
+		return errs
+	}
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize:        2,
+		PoolSize:         1,
+		Timeout:          10 * time.Millisecond,
+		MaxAttempts:      4,
+		RetryBackoffBase: time.Millisecond,
+		RetryBackoffMax:  5 * time.Millisecond,
+		IsRetryable: func(err error) bool {
+			return errors.Is(err, errTransient)
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	permanent := b.AddAsync(0)
+	transient := b.AddAsync(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := permanent.WaitContext(ctx); !errors.Is(err, errPermanent) {
+		t.Errorf("期望 errPermanent, 实际 %v", err)
+	}
+	if err := transient.WaitContext(ctx); !errors.Is(err, errTransient) {
+		t.Errorf("期望 errTransient, 实际 %v", err)
+	}
+	if got := rec.attemptsOf(0); got != 1 {
+		t.Errorf("不可重试错误被处理了 %d 次", got)
+	}
+	if got := rec.attemptsOf(1); got != 4 {
+		t.Errorf("可重试错误期望处理 4 次, 实际 %d 次", got)
+	}
+}
+
+// TestRetryRebatchedWithFreshItems 验证重试的数据与新数据合并成批，而不是单独重试
+func TestRetryRebatchedWithFreshItems(t *testing.T) {
+	rec := newAttemptRecorder()
+	processor := func(items []int) []error {
+		counts := rec.record(items)
+		errs := make([]error, len(items))
+		for i, item := range items {
+			if item == 0 && counts[i] == 1 {
+				errs[i] = errTransient
+			}
+		}
+		return errs
+	}
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize:        5,
+		PoolSize:         1,
+		Timeout:          time.Hour,
+		MaxAttempts:      2,
+		RetryBackoffBase: 5 * time.Millisecond,
+		RetryBackoffMax:  5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	for i := 0; i < 5; i++ {
+		b.Add(i)
+	}
+	// 等待第一批处理完成且重试到期
+	time.Sleep(50 * time.Millisecond)
+	for i := 5; i < 9; i++ {
+		b.Add(i)
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.batches) != 2 {
+		t.Fatalf("期望 2 个批次, 实际 %v", rec.batches)
+	}
+	if want := []int{0, 5, 6, 7, 8}; !slices.Equal(rec.batches[1], want) {
+		t.Errorf("重试批次期望 %v, 实际 %v", want, rec.batches[1])
+	}
+}
+
+// TestShutdownWaitsForRetries 验证Shutdown会等待重试完成
+func TestShutdownWaitsForRetries(t *testing.T) {
+	rec := newAttemptRecorder()
+	processor := func(items []int) []error {
+		counts := rec.record(items)
+		errs := make([]error, len(items))
+		for i := range items {
+			if counts[i] == 1 {
+				errs[i] = errTransient
+			}
+		}
+		return errs
+	}
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize:        10,
+		PoolSize:         2,
+		Timeout:          time.Hour,
+		MaxAttempts:      2,
+		RetryBackoffBase: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	futures := make([]*batcher.Future, 25)
+	for i := range futures {
+		futures[i] = b.AddAsync(i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown失败: %v", err)
+	}
+	for i, f := range futures {
+		if err := f.Wait(); err != nil {
+			t.Errorf("item %d: 期望重试后成功, 实际 %v", i, err)
+		}
+	}
+}
+
+// TestRetryKeepsOrder 验证ORDERED_SEQUENTIAL和KEY_HASH下重试的数据不会被后续数据超过
+func TestRetryKeepsOrder(t *testing.T) {
+	for _, policy := range []batcher.SchedulingPolicy{batcher.ORDERED_SEQUENTIAL, batcher.KEY_HASH} {
+		rec := newAttemptRecorder()
+		var mu sync.Mutex
+		var succeeded []int
+		b, err := batcher.NewChanBatcher[int](func(items []int) []error {
+			counts := rec.record(items)
+			errs := make([]error, len(items))
+			mu.Lock()
+			defer mu.Unlock()
+			for i, item := range items {
+				// 1第一次失败
+				if item == 1 && counts[i] == 1 {
+					errs[i] = errTransient
+					continue
+				}
+				succeeded = append(succeeded, item)
+			}
+			return errs
+		}, batcher.BatchConfig{
+			BatchSize:        1,
+			PoolSize:         2,
+			Timeout:          time.Hour,
+			SchedulingPolicy: policy,
+			MaxAttempts:      3,
+			RetryBackoffBase: 20 * time.Millisecond,
+		}, batcher.WithPartitionKey(func(int) string { return "same" }))
+		if err != nil {
+			t.Fatalf("创建批处理器失败: %v", err)
+		}
+
+		futures := make([]*batcher.Future, 5)
+		for i := range futures {
+			futures[i] = b.AddAsync(i + 1)
+		}
+		for i, f := range futures {
+			if err := f.Wait(); err != nil {
+				t.Errorf("策略 %d: 数据 %d 期望成功, 实际 %v", policy, i+1, err)
+			}
+		}
+		b.Stop()
+
+		mu.Lock()
+		if !slices.Equal(succeeded, []int{1, 2, 3, 4, 5}) {
+			t.Errorf("策略 %d: 重试的数据被后续数据超过: %v", policy, succeeded)
+		}
+		mu.Unlock()
+		if n := rec.attemptsOf(1); n != 2 {
+			t.Errorf("策略 %d: 数据1期望处理 2 次, 实际 %d", policy, n)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// TestShutdownDrainsBufferedItems 验证Shutdown会处理完缓冲区和队列中的所有数据
+func TestShutdownDrainsBufferedItems(t *testing.T) {
+	var processed int64
+	processor := func(items []int) []error {
+		atomic.AddInt64(&processed, int64(len(items)))
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+
+	// 超时时间很长，数据只会停留在worker缓冲区和队列中
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 50,
+		PoolSize:  4,
+		QueueSize: 1000,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	const total = 987
+	for i := 0; i < total; i++ {
+		if err := b.Add(i); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown失败: %v", err)
+	}
+
+	if got := atomic.LoadInt64(&processed); got != total {
+		t.Errorf("处理数量不匹配: 预期 %d, 实际 %d", total, got)
+	}
+	if err := b.Add(1); !errors.Is(err, batcher.ErrBatcherStopped) {
+		t.Errorf("Shutdown后期望 ErrBatcherStopped, 实际 %v", err)
+	}
+}
+
+// TestShutdownDeadlineReportsLostItems 验证超过截止时间时报告丢失数量
+func TestShutdownDeadlineReportsLostItems(t *testing.T) {
+	release := make(chan struct{})
+	processor := func(items []int) []error {
+		<-release
+		return nil
+	}
+	defer close(release)
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  1,
+		QueueSize: 100,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	futures := make([]*batcher.Future, 35)
+	for i := range futures {
+		futures[i] = b.AddAsync(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = b.Shutdown(ctx)
+
+	var drainErr *batcher.DrainError
+	if !errors.As(err, &drainErr) {
+		t.Fatalf("期望 *DrainError, 实际 %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望包装 context.DeadlineExceeded, 实际 %v", drainErr.Err)
+	}
+	if drainErr.Lost != int64(len(futures)) {
+		t.Errorf("丢失数量不匹配: 预期 %d, 实际 %d", len(futures), drainErr.Lost)
+	}
+
+	// 仍在队列中的数据必须被解析为已停止
+	if err := futures[len(futures)-1].Wait(); !errors.Is(err, batcher.ErrBatcherStopped) {
+		t.Errorf("队列中数据期望 ErrBatcherStopped, 实际 %v", err)
+	}
+}
+
+// TestShutdownConcurrentAdd 验证Shutdown期间并发Add不会丢失已接收的数据
+func TestShutdownConcurrentAdd(t *testing.T) {
+	var processed int64
+	processor := func(items []int) []error {
+		atomic.AddInt64(&processed, int64(len(items)))
+		return nil
+	}
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 16,
+		PoolSize:  3,
+		QueueSize: 64,
+		Timeout:   50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	var accepted int64
+	done := make(chan struct{})
+	for p := 0; p < 8; p++ {
+		go func() {
+			for i := 0; ; i++ {
+				if err := b.Add(i); err != nil {
+					done <- struct{}{}
+					return
+				}
+				atomic.AddInt64(&accepted, 1)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown失败: %v", err)
+	}
+	for p := 0; p < 8; p++ {
+		<-done
+	}
+
+	if atomic.LoadInt64(&processed) != atomic.LoadInt64(&accepted) {
+		t.Errorf("已接收 %d 项, 但只处理了 %d 项", accepted, processed)
+	}
+}
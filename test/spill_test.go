@@ -0,0 +1,163 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// newSpillBatcher 创建处理器被阻塞、队列很小的溢出到磁盘批处理器
+func newSpillBatcher(t *testing.T, maxBytes int64) *blockedBatcher[int] {
+	t.Helper()
+	return newBlockedBatcher[int](t, batcher.BatchConfig{
+		QueueSize:      4,
+		OverflowPolicy: batcher.OVERFLOW_SPILL_TO_DISK,
+		SpillDir:       t.TempDir(),
+		SpillMaxBytes:  maxBytes,
+	})
+}
+
+// TestSpillAbsorbsBurst 验证队列满时数据溢出到磁盘，之后按顺序读回处理
+func TestSpillAbsorbsBurst(t *testing.T) {
+	b := newSpillBatcher(t, 0)
+
+	const total = 500
+	added := make(chan error, 1)
+	go func() {
+		for i := 0; i < total; i++ {
+			if err := b.Add(i); err != nil {
+				added <- err
+				return
+			}
+		}
+		added <- nil
+	}()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("队列满时Add被阻塞")
+	}
+	if spilled := b.Stats().Spilled; spilled < total-10 {
+		t.Errorf("溢出数量过少: %d", spilled)
+	}
+
+	processed := b.drain(t)
+	if len(processed) != total {
+		t.Fatalf("处理数量不匹配: 预期 %d, 实际 %d", total, len(processed))
+	}
+	for i, v := range processed {
+		if v != i {
+			t.Fatalf("溢出数据未按顺序处理: 位置 %d 为 %d", i, v)
+		}
+	}
+	if got := b.Stats().Spilled; got != 0 {
+		t.Errorf("Shutdown后仍有溢出数据: %d", got)
+	}
+}
+
+// TestSpillBudgetFallsBackToBlocking 验证超出磁盘预算后不再溢出
+func TestSpillBudgetFallsBackToBlocking(t *testing.T) {
+	b := newSpillBatcher(t, 256)
+
+	accepted := 0
+	for i := 0; i < 1000 && b.TryAdd(i); i++ {
+		accepted++
+	}
+	if accepted == 1000 {
+		t.Fatal("超出磁盘预算后TryAdd仍然成功")
+	}
+	if b.Stats().Spilled == 0 {
+		t.Error("预算内的数据应溢出到磁盘")
+	}
+
+	blocked := make(chan error, 1)
+	go func() { blocked <- b.Add(-1) }()
+	select {
+	case err := <-blocked:
+		t.Fatalf("超出预算后Add应阻塞, 实际返回 %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.unblock()
+	select {
+	case err := <-blocked:
+		if err != nil {
+			t.Errorf("解除阻塞后Add失败: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("队列有空间后Add仍然阻塞")
+	}
+}
+
+// TestSpillOverBudgetKeepsOrder 验证超出磁盘预算后阻塞的数据不会越过溢出数据
+func TestSpillOverBudgetKeepsOrder(t *testing.T) {
+	b := newSpillBatcher(t, 2000)
+
+	const total = 2000
+	added := make(chan error, 1)
+	go func() {
+		for i := 0; i < total; i++ {
+			if err := b.Add(i); err != nil {
+				added <- err
+				return
+			}
+		}
+		added <- nil
+	}()
+	// 等待溢出文件写满、生产者阻塞
+	time.Sleep(50 * time.Millisecond)
+	b.unblock()
+	if err := <-added; err != nil {
+		t.Fatalf("添加数据失败: %v", err)
+	}
+	processed := b.drain(t)
+	if len(processed) != total {
+		t.Fatalf("处理数量不匹配: 预期 %d, 实际 %d", total, len(processed))
+	}
+	for i, v := range processed {
+		if v != i {
+			t.Fatalf("超出预算后数据未按顺序处理: 位置 %d 为 %d", i, v)
+		}
+	}
+}
+
+// TestSpillStopResolvesFutures 验证Stop时溢出数据的Future被解析为已停止
+func TestSpillStopResolvesFutures(t *testing.T) {
+	b := newSpillBatcher(t, 0)
+
+	futures := make([]*batcher.Future, 50)
+	for i := range futures {
+		futures[i] = b.AddAsync(i)
+	}
+	b.Stop()
+
+	last := futures[len(futures)-1]
+	select {
+	case <-last.Done():
+		if !errors.Is(last.Wait(), batcher.ErrBatcherStopped) {
+			t.Errorf("期望 ErrBatcherStopped, 实际 %v", last.Wait())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop后溢出数据的Future未解析")
+	}
+	if pending := b.Stats().Pending; pending > 1 {
+		t.Errorf("Stop后仍有未解析的数据: %d", pending)
+	}
+}
+
+// TestSpillRequiresDir 验证溢出到磁盘但未设置目录时返回错误
+func TestSpillRequiresDir(t *testing.T) {
+	_, err := batcher.NewChanBatcher(func(items []int) []error { return nil }, batcher.BatchConfig{
+		BatchSize:      10,
+		PoolSize:       1,
+		Timeout:        time.Second,
+		OverflowPolicy: batcher.OVERFLOW_SPILL_TO_DISK,
+	})
+	if !errors.Is(err, batcher.ErrSpillDirNotSet) {
+		t.Errorf("期望 ErrSpillDirNotSet, 实际 %v", err)
+	}
+}
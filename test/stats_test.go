@@ -0,0 +1,99 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// TestStatsCounters 验证Stats中的计数与实际处理情况一致
+func TestStatsCounters(t *testing.T) {
+	processor := func(items []int) []error {
+		time.Sleep(time.Millisecond)
+		errs := make([]error, len(items))
+		for i, item := range items {
+			if item%10 == 0 {
+				errs[i] = errPermanent
+			}
+		}
+		return errs
+	}
+
+	b, err := batcher.NewChanBatcher[int](processor, batcher.BatchConfig{
+		BatchSize: 10,
+		PoolSize:  3,
+		QueueSize: 200,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	st := b.Stats()
+	if st.QueueCapacity != 200 || st.LiveWorkers != 3 {
+		t.Fatalf("初始状态不符合预期: %+v", st)
+	}
+	if st.CurrentBatchSize != 10 {
+		t.Errorf("CurrentBatchSize 期望 10, 实际 %d", st.CurrentBatchSize)
+	}
+
+	for i := 0; i < 95; i++ {
+		b.Add(i)
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush失败: %v", err)
+	}
+
+	st = b.Stats()
+	if st.Added != 95 || st.Processed != 85 || st.Failed != 10 || st.Pending != 0 {
+		t.Errorf("计数不符合预期: added=%d processed=%d failed=%d pending=%d",
+			st.Added, st.Processed, st.Failed, st.Pending)
+	}
+	var batches uint64
+	for _, n := range st.Batches {
+		batches += n
+	}
+	if batches < 10 || st.Batches[batcher.TRIGGER_FLUSH] == 0 {
+		t.Errorf("批次统计不符合预期: %v", st.Batches)
+	}
+	if st.Batches[batcher.TRIGGER_TIMEOUT] != 0 {
+		t.Errorf("不应出现超时批次: %v", st.Batches)
+	}
+	if st.ProcessLatencyP50 < time.Millisecond || st.ProcessLatencyP99 < st.ProcessLatencyP50 {
+		t.Errorf("延迟分位数不符合预期: p50=%v p90=%v p99=%v",
+			st.ProcessLatencyP50, st.ProcessLatencyP90, st.ProcessLatencyP99)
+	}
+	if st.InFlightBatches != 0 {
+		t.Errorf("Flush后不应有处理中的批次: %d", st.InFlightBatches)
+	}
+
+	// Stop丢弃的数据计入Dropped
+	release := make(chan struct{})
+	blocking, err := batcher.NewChanBatcher[int](func(items []int) []error {
+		<-release
+		return nil
+	}, batcher.BatchConfig{BatchSize: 1, PoolSize: 1, QueueSize: 10, Timeout: time.Hour})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		blocking.Add(i)
+	}
+	// 等待第一条数据进入处理器
+	for blocking.Stats().InFlightBatches == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	blocking.Stop()
+	close(release)
+	if st := blocking.Stats(); st.Dropped != 4 {
+		t.Errorf("Dropped 期望 4, 实际 %d", st.Dropped)
+	}
+
+	b.Stop()
+	time.Sleep(50 * time.Millisecond)
+	if st := b.Stats(); st.LiveWorkers != 0 {
+		t.Errorf("Stop后 LiveWorkers 期望 0, 实际 %d", st.LiveWorkers)
+	}
+}
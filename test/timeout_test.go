@@ -0,0 +1,234 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// TestProcessTimeoutAbandonsHungBatch 验证卡住的处理器被放弃，worker继续处理后续数据
+func TestProcessTimeoutAbandonsHungBatch(t *testing.T) {
+	release := make(chan struct{})
+	var slow atomic.Int32
+	var slowInfo atomic.Value
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		if items[0] < 0 {
+			// 模拟不响应的HTTP调用
+			<-release
+		}
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:      1,
+		PoolSize:       1,
+		Timeout:        time.Hour,
+		ProcessTimeout: 20 * time.Millisecond,
+		OnSlowBatch: func(info batcher.BatchInfo) {
+			slow.Add(1)
+			slowInfo.Store(info)
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	err = b.AddAsync(-1).Wait()
+	if !errors.Is(err, batcher.ErrProcessTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望 ErrProcessTimeout, 实际 %v", err)
+	}
+	if err := b.AddAsync(1).Wait(); err != nil {
+		t.Errorf("超时后worker应继续处理, 实际 %v", err)
+	}
+
+	if got := slow.Load(); got != 1 {
+		t.Errorf("OnSlowBatch 期望调用 1 次, 实际 %d", got)
+	}
+	if info, _ := slowInfo.Load().(batcher.BatchInfo); info.Size != 1 || info.Duration < 20*time.Millisecond {
+		t.Errorf("OnSlowBatch 批次信息不正确: %+v", info)
+	}
+	st := b.Stats()
+	if st.TimedOut != 1 || st.Failed != 1 || st.Processed != 1 {
+		t.Errorf("统计不正确: TimedOut=%d Failed=%d Processed=%d", st.TimedOut, st.Failed, st.Processed)
+	}
+	if st.AbandonedBatches != 1 {
+		t.Errorf("被放弃的处理器调用期望 1, 实际 %d", st.AbandonedBatches)
+	}
+
+	// 被放弃的调用返回后不再计入
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Stats().AbandonedBatches != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := b.Stats().AbandonedBatches; n != 0 {
+		t.Errorf("处理器返回后被放弃的调用期望 0, 实际 %d", n)
+	}
+}
+
+// TestProcessTimeoutRetries 验证超时的数据按重试策略重新处理
+func TestProcessTimeoutRetries(t *testing.T) {
+	var calls atomic.Int32
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		if calls.Add(1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:        2,
+		PoolSize:         1,
+		Timeout:          10 * time.Millisecond,
+		ProcessTimeout:   20 * time.Millisecond,
+		MaxAttempts:      2,
+		RetryBackoffBase: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	futures := []*batcher.Future{b.AddAsync(1), b.AddAsync(2)}
+	for i, f := range futures {
+		if err := f.Wait(); err != nil {
+			t.Errorf("重试后数据 %d 期望成功, 实际 %v", i, err)
+		}
+	}
+	if st := b.Stats(); st.TimedOut != 2 || st.Retried != 2 {
+		t.Errorf("统计不正确: TimedOut=%d Retried=%d", st.TimedOut, st.Retried)
+	}
+}
+
+// TestProcessTimeoutKeepsKeyOrder 验证KEY_HASH下超时不放弃处理器调用，同key数据保持顺序
+func TestProcessTimeoutKeepsKeyOrder(t *testing.T) {
+	var order []int
+	var slow atomic.Int32
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		if items[0] == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		order = append(order, items...)
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:        1,
+		PoolSize:         2,
+		Timeout:          time.Hour,
+		ProcessTimeout:   20 * time.Millisecond,
+		SchedulingPolicy: batcher.KEY_HASH,
+		OnSlowBatch:      func(batcher.BatchInfo) { slow.Add(1) },
+	}, batcher.WithPartitionKey(func(v int) string { return "same" }))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	first, second := b.AddAsync(0), b.AddAsync(1)
+	for i, f := range []*batcher.Future{first, second} {
+		if err := f.Wait(); err != nil {
+			t.Errorf("处理器最终成功时数据 %d 期望成功, 实际 %v", i, err)
+		}
+	}
+	if len(order) != 2 || order[0] != 0 || order[1] != 1 {
+		t.Errorf("同key数据顺序不正确: %v", order)
+	}
+	if got := slow.Load(); got != 1 {
+		t.Errorf("OnSlowBatch 期望调用 1 次, 实际 %d", got)
+	}
+	if n := b.Stats().AbandonedBatches; n != 0 {
+		t.Errorf("KEY_HASH下不应放弃处理器调用, 实际 %d", n)
+	}
+}
+
+// TestProcessTimeoutReportsWhileWaiting 验证KEY_HASH下超时即调用OnSlowBatch并计入统计，无需等待处理器返回
+func TestProcessTimeoutReportsWhileWaiting(t *testing.T) {
+	release := make(chan struct{})
+	slow := make(chan batcher.BatchInfo, 1)
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		<-release
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:        1,
+		PoolSize:         1,
+		Timeout:          time.Hour,
+		ProcessTimeout:   20 * time.Millisecond,
+		SchedulingPolicy: batcher.KEY_HASH,
+		OnSlowBatch:      func(info batcher.BatchInfo) { slow <- info },
+	}, batcher.WithPartitionKey(func(v int) string { return "same" }))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	f := b.AddAsync(1)
+	select {
+	case info := <-slow:
+		if info.Size != 1 || info.Failed != 0 || info.Duration < 20*time.Millisecond {
+			t.Errorf("OnSlowBatch 批次信息不正确: %+v", info)
+		}
+	case <-time.After(2 * time.Second):
+		close(release)
+		t.Fatal("处理器未返回时 OnSlowBatch 未被调用")
+	}
+	if n := b.Stats().TimedOut; n != 1 {
+		t.Errorf("超时时 TimedOut 期望 1, 实际 %d", n)
+	}
+
+	// 处理器成功返回，数据保持成功
+	close(release)
+	if err := f.Wait(); err != nil {
+		t.Errorf("处理器最终成功时期望成功, 实际 %v", err)
+	}
+	st := b.Stats()
+	if st.TimedOut != 1 || st.AbandonedBatches != 0 {
+		t.Errorf("统计不正确: TimedOut=%d AbandonedBatches=%d", st.TimedOut, st.AbandonedBatches)
+	}
+	if len(slow) != 0 {
+		t.Error("OnSlowBatch 不应重复调用")
+	}
+}
+
+// TestProcessTimeoutAbandonsOneCallPerWorker 验证每个worker同时最多放弃一次调用
+func TestProcessTimeoutAbandonsOneCallPerWorker(t *testing.T) {
+	release := make(chan struct{})
+	b, err := batcher.NewChanBatcher(func(items []int) []error {
+		<-release
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:      1,
+		PoolSize:       1,
+		Timeout:        time.Hour,
+		ProcessTimeout: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+
+	if err := b.AddAsync(1).Wait(); !errors.Is(err, batcher.ErrProcessTimeout) {
+		t.Fatalf("期望 ErrProcessTimeout, 实际 %v", err)
+	}
+	second := b.AddAsync(2)
+	time.Sleep(50 * time.Millisecond)
+	if n := b.Stats().AbandonedBatches; n != 1 {
+		t.Errorf("被放弃的调用期望 1, 实际 %d", n)
+	}
+	select {
+	case <-second.Done():
+		t.Fatal("上一次被放弃的调用仍在运行时不应再放弃")
+	default:
+	}
+
+	close(release)
+	if err := second.Wait(); err != nil {
+		t.Errorf("处理器返回后数据期望成功, 实际 %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Stats().AbandonedBatches != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := b.Stats().AbandonedBatches; n != 0 {
+		t.Errorf("处理器返回后被放弃的调用期望 0, 实际 %d", n)
+	}
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+type ctxKey struct{}
+
+// recordingTracer 记录每个批次收到的调用方context
+type recordingTracer struct {
+	mu    sync.Mutex
+	links [][]context.Context
+	ended []batcher.BatchInfo
+}
+
+func (r *recordingTracer) StartBatch(ctx context.Context, info batcher.BatchInfo, links []context.Context) func(batcher.BatchInfo) {
+	r.mu.Lock()
+	r.links = append(r.links, links)
+	r.mu.Unlock()
+	return func(done batcher.BatchInfo) {
+		r.mu.Lock()
+		r.ended = append(r.ended, done)
+		r.mu.Unlock()
+	}
+}
+
+// TestAddContextPassesLinksToTracer 验证AddContext的context按数据顺序传给Tracer
+func TestAddContextPassesLinksToTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	b, err := batcher.NewChanBatcher[int](func(items []int) []error {
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize: 3,
+		PoolSize:  1,
+		Timeout:   time.Hour,
+		Tracer:    tracer,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+
+	b.AddContext(context.WithValue(context.Background(), ctxKey{}, "req-1"), 1)
+	b.Add(2)
+	b.AddContext(context.WithValue(context.Background(), ctxKey{}, "req-3"), 3)
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown失败: %v", err)
+	}
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if len(tracer.links) != 1 || len(tracer.ended) != 1 {
+		t.Fatalf("期望 1 个批次span, 实际 start=%d end=%d", len(tracer.links), len(tracer.ended))
+	}
+	links := tracer.links[0]
+	if len(links) != 3 || links[1] != nil {
+		t.Fatalf("links不符合预期: %v", links)
+	}
+	if links[0].Value(ctxKey{}) != "req-1" || links[2].Value(ctxKey{}) != "req-3" {
+		t.Errorf("links顺序与数据不一致")
+	}
+	if tracer.ended[0].Size != 3 {
+		t.Errorf("结束时批次大小期望 3, 实际 %d", tracer.ended[0].Size)
+	}
+}
+
+// TestAddContextDeadlineUnderBackpressure 验证队列满时AddContext按调用方截止时间返回
+func TestAddContextDeadlineUnderBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	b, err := batcher.NewChanBatcher[int](func(items []int) []error {
+		<-release
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize: 1,
+		PoolSize:  1,
+		QueueSize: 2,
+		Timeout:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	defer b.Stop()
+	defer close(release)
+
+	// 一条在处理器中，两条占满队列
+	for i := 0; i < 3; i++ {
+		if err := b.Add(i); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = b.AddContext(ctx, 99)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("期望 context.DeadlineExceeded, 实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("AddContext阻塞时间过长: %v", elapsed)
+	}
+
+	st := b.Stats()
+	if st.Added != 3 || st.Pending != 3 {
+		t.Errorf("超时的数据不应计入: added=%d pending=%d", st.Added, st.Pending)
+	}
+
+	// 已取消的context直接返回，即使队列有空间
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if err := b.AddContext(cancelled, 100); err != context.Canceled {
+		t.Errorf("期望 context.Canceled, 实际 %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+type walRow struct {
+	ID   int
+	Name string
+}
+
+// TestDurabilityReplaysUnprocessedItems 验证Stop丢弃的数据在重启后从预写日志重新投递
+func TestDurabilityReplaysUnprocessedItems(t *testing.T) {
+	dir := t.TempDir()
+	config := batcher.BatchConfig{
+		BatchSize:  100,
+		PoolSize:   2,
+		Timeout:    time.Hour,
+		Durability: batcher.DURABILITY_SYNC,
+		WALDir:     dir,
+	}
+
+	// 第一次运行：数据停留在缓冲区中，模拟进程崩溃前未处理
+	first, err := batcher.NewChanBatcher(func(items []walRow) []error { return nil }, config)
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		if err := first.Add(walRow{ID: i, Name: "row"}); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+	first.Stop()
+
+	// 第二次运行：未处理的数据按原顺序重新投递
+	var mu sync.Mutex
+	var got []walRow
+	second, err := batcher.NewChanBatcher(func(items []walRow) []error {
+		mu.Lock()
+		got = append(got, items...)
+		mu.Unlock()
+		return nil
+	}, config)
+	if err != nil {
+		t.Fatalf("重启批处理器失败: %v", err)
+	}
+	if err := second.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown失败: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 25 {
+		t.Fatalf("重新投递数量不匹配: 预期 25, 实际 %d", len(got))
+	}
+	seen := make(map[int]bool)
+	for _, row := range got {
+		if row.Name != "row" || seen[row.ID] {
+			t.Errorf("重新投递的数据不正确: %+v", row)
+		}
+		seen[row.ID] = true
+	}
+}
+
+// TestDurabilityTruncatesProcessedItems 验证处理成功的数据不会被重新投递，且日志段会被删除
+func TestDurabilityTruncatesProcessedItems(t *testing.T) {
+	dir := t.TempDir()
+	config := batcher.BatchConfig{
+		BatchSize:      10,
+		PoolSize:       2,
+		Timeout:        time.Hour,
+		Durability:     batcher.DURABILITY_BUFFERED,
+		WALDir:         dir,
+		WALSegmentSize: 512,
+	}
+
+	first, err := batcher.NewChanBatcher(func(items []walRow) []error { return nil }, config)
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := first.Add(walRow{ID: i}); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+	if err := first.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown失败: %v", err)
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if len(segments) > 2 {
+		t.Errorf("已处理的日志段未被删除: 剩余 %d 个文件", len(segments))
+	}
+
+	var replayed int
+	second, err := batcher.NewChanBatcher(func(items []walRow) []error {
+		replayed += len(items)
+		return nil
+	}, config)
+	if err != nil {
+		t.Fatalf("重启批处理器失败: %v", err)
+	}
+	if err := second.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown失败: %v", err)
+	}
+	if replayed != 0 {
+		t.Errorf("已处理的数据被重新投递: %d 项", replayed)
+	}
+}
+
+// TestDurabilityRequiresDir 验证启用Durability但未设置目录时返回错误
+func TestDurabilityRequiresDir(t *testing.T) {
+	_, err := batcher.NewChanBatcher(func(items []int) []error { return nil }, batcher.BatchConfig{
+		BatchSize:  10,
+		PoolSize:   1,
+		Timeout:    time.Second,
+		Durability: batcher.DURABILITY_BUFFERED,
+	})
+	if !errors.Is(err, batcher.ErrWALDirNotSet) {
+		t.Errorf("期望 ErrWALDirNotSet, 实际 %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	batcher "github.com/PaienNate/batchy"
+)
+
+// newWeightBatcher 创建按字符串长度计算权重的批处理器，记录每个批次
+func newWeightBatcher(t *testing.T, maxWeight int, policy batcher.OversizePolicy) (batcher.Batcher[string], func() [][]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var batches [][]string
+	b, err := batcher.NewChanBatcher(func(items []string) []error {
+		mu.Lock()
+		batches = append(batches, append([]string(nil), items...))
+		mu.Unlock()
+		return nil
+	}, batcher.BatchConfig{
+		BatchSize:      1000,
+		PoolSize:       2,
+		QueueSize:      1,
+		Timeout:        time.Hour,
+		MaxBatchWeight: maxWeight,
+		OversizePolicy: policy,
+	}, batcher.WithWeight(func(s string) int { return len(s) }))
+	if err != nil {
+		t.Fatalf("创建批处理器失败: %v", err)
+	}
+	t.Cleanup(b.Stop)
+	return b, func() [][]string {
+		if err := b.Flush(context.Background()); err != nil {
+			t.Fatalf("Flush失败: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+// TestWeightCapsBatches 验证每个批次的总权重不超过MaxBatchWeight
+func TestWeightCapsBatches(t *testing.T) {
+	b, batches := newWeightBatcher(t, 100, batcher.OVERSIZE_EMIT_ALONE)
+
+	const total = 300
+	for i := 0; i < total; i++ {
+		if err := b.Add(strings.Repeat("x", 1+i*7%40)); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+
+	count := 0
+	for _, batch := range batches() {
+		weight := 0
+		for _, s := range batch {
+			weight += len(s)
+		}
+		if weight > 100 {
+			t.Errorf("批次权重 %d 超过上限100", weight)
+		}
+		count += len(batch)
+	}
+	if count != total {
+		t.Errorf("处理数量不匹配: 预期 %d, 实际 %d", total, count)
+	}
+	if b.Stats().Batches[batcher.TRIGGER_WEIGHT] == 0 {
+		t.Error("期望有因权重触发的批次")
+	}
+}
+
+// TestWeightOversizeEmittedAlone 验证超过上限的单条数据单独成批
+func TestWeightOversizeEmittedAlone(t *testing.T) {
+	b, batches := newWeightBatcher(t, 100, batcher.OVERSIZE_EMIT_ALONE)
+
+	huge := strings.Repeat("h", 150)
+	for _, s := range []string{"a", "b", huge, "c"} {
+		if err := b.Add(s); err != nil {
+			t.Fatalf("添加数据失败: %v", err)
+		}
+	}
+
+	found := false
+	for _, batch := range batches() {
+		for _, s := range batch {
+			if s == huge {
+				found = true
+				if len(batch) != 1 {
+					t.Errorf("超大数据应单独成批, 实际批次大小 %d", len(batch))
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("超大数据未被处理")
+	}
+}
+
+// TestWeightOversizeRejected 验证OVERSIZE_REJECT拒绝超过上限的数据
+func TestWeightOversizeRejected(t *testing.T) {
+	b, _ := newWeightBatcher(t, 100, batcher.OVERSIZE_REJECT)
+
+	huge := strings.Repeat("h", 101)
+	if err := b.Add(huge); !errors.Is(err, batcher.ErrItemTooLarge) {
+		t.Errorf("期望 ErrItemTooLarge, 实际 %v", err)
+	}
+	if err := b.AddAsync(huge).Wait(); !errors.Is(err, batcher.ErrItemTooLarge) {
+		t.Errorf("Future期望 ErrItemTooLarge, 实际 %v", err)
+	}
+	if err := b.Add(strings.Repeat("x", 100)); err != nil {
+		t.Errorf("恰好等于上限的数据应被接收, 实际 %v", err)
+	}
+	if added := b.Stats().Added; added != 1 {
+		t.Errorf("被拒绝的数据不应计入Added: %d", added)
+	}
+}
+
+// TestWeightRequiresWeightFunc 验证设置MaxBatchWeight但未提供权重函数时返回错误
+func TestWeightRequiresWeightFunc(t *testing.T) {
+	_, err := batcher.NewChanBatcher(func(items []string) []error { return nil }, batcher.BatchConfig{
+		BatchSize:      10,
+		PoolSize:       1,
+		Timeout:        time.Second,
+		MaxBatchWeight: 1024,
+	})
+	if !errors.Is(err, batcher.ErrWeightFuncNotSet) {
+		t.Errorf("期望 ErrWeightFuncNotSet, 实际 %v", err)
+	}
+}
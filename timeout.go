@@ -0,0 +1,135 @@
+package batchy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrProcessTimeout is reported for the items of a batch whose processor call
+// exceeded ProcessTimeout. It matches context.DeadlineExceeded as well.
+var ErrProcessTimeout = fmt.Errorf("batchy: processor exceeded ProcessTimeout: %w", context.DeadlineExceeded)
+
+// States of a processor call that runs under ProcessTimeout
+const (
+	callRunning int32 = iota
+	callReturned
+	callAbandoned
+)
+
+// call runs fn on the entries of batch, giving up on it once timeout elapses.
+// An abandoned call keeps running in the background and its result is
+// discarded; every item is reported as ErrProcessTimeout. A call that returns
+// after its context expired has its failed items reported as
+// ErrProcessTimeout, the items it did process keep their result. Either way
+// the batch is reported as slow.
+//
+// Under ORDERED_SEQUENTIAL and KEY_HASH the next batch must not overtake this
+// one, so the call is never abandoned: the batch is reported as slow once the
+// timeout elapses and the worker keeps waiting for the call. A worker also
+// waits while a call it abandoned earlier is still running, which bounds the
+// abandoned calls by the number of workers.
+func (w *batchWorker[T]) call(ctx context.Context, fn ContextProcessor[T], entries []entry[T], batch Batch[T], timeout time.Duration) []error {
+	if timeout <= 0 {
+		return w.invoke(ctx, fn, batch)
+	}
+	c := w.c
+	start := time.Now()
+	wait := c.ordered() || w.stuck.Load()
+	var state atomic.Int32
+	result := make(chan []error, 1)
+	go func() {
+		errs := w.invoke(ctx, fn, batch)
+		if !state.CompareAndSwap(callRunning, callReturned) {
+			c.stats.abandoned.Add(-1)
+			w.stuck.Store(false)
+			return
+		}
+		result <- errs
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case errs := <-result:
+		return w.expired(ctx, entries, batch, errs, start)
+	case <-timer.C:
+	}
+	if wait {
+		w.slow(entries, batch, time.Since(start), 0)
+		errs, _ := w.mark(ctx, batch, <-result)
+		return errs
+	}
+	// Counted first so that the call cannot be uncounted before
+	c.stats.abandoned.Add(1)
+	w.stuck.Store(true)
+	if !state.CompareAndSwap(callRunning, callAbandoned) {
+		// Returned while the timer fired
+		c.stats.abandoned.Add(-1)
+		w.stuck.Store(false)
+		return w.expired(ctx, entries, batch, <-result, start)
+	}
+	// The abandoned call still reads the scratch space
+	w.items = make([]T, 0, cap(w.items))
+	w.enqueued = make([]time.Time, 0, cap(w.enqueued))
+	errs := make([]error, len(batch.Items))
+	for i := range errs {
+		errs[i] = ErrProcessTimeout
+	}
+	w.slow(entries, batch, time.Since(start), len(errs))
+	return errs
+}
+
+// expired reports the batch as slow if its call returned after its context
+// expired, marking the failed items as ErrProcessTimeout
+func (w *batchWorker[T]) expired(ctx context.Context, entries []entry[T], batch Batch[T], errs []error, start time.Time) []error {
+	errs, failed := w.mark(ctx, batch, errs)
+	if failed >= 0 {
+		w.slow(entries, batch, time.Since(start), failed)
+	}
+	return errs
+}
+
+// mark replaces the errors of a call that returned after its context expired
+// with ErrProcessTimeout and returns how many there were, or -1 if the call
+// returned in time
+func (w *batchWorker[T]) mark(ctx context.Context, batch Batch[T], errs []error) ([]error, int) {
+	// A processor honouring ctx returns as soon as the deadline passes,
+	// unless the batcher itself was stopped
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) || w.c.ctx.Err() != nil {
+		return errs, -1
+	}
+	marked := make([]error, len(batch.Items))
+	failed := 0
+	for i := range marked {
+		if i < len(errs) && errs[i] != nil {
+			marked[i] = ErrProcessTimeout
+			failed++
+		}
+	}
+	return marked, failed
+}
+
+// slow counts the items of a batch whose call exceeded ProcessTimeout and
+// passes it to the OnSlowBatch hook
+func (w *batchWorker[T]) slow(entries []entry[T], batch Batch[T], elapsed time.Duration, failed int) {
+	c := w.c
+	n := 0
+	for i := range entries {
+		n += entries[i].settles()
+	}
+	c.stats.timedOut.Add(uint64(n))
+	if c.onSlowBatch == nil {
+		return
+	}
+	info := BatchInfo{
+		WorkerID: w.id,
+		Size:     len(entries),
+		Trigger:  batch.Trigger,
+		Duration: elapsed,
+		Failed:   failed,
+	}
+	w.safely(func() { c.onSlowBatch(info) })
+}
@@ -0,0 +1,315 @@
+package batchy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentExt   = ".wal"
+	recordItem   = byte(1)
+	recordAck    = byte(2)
+	recordHeader = 8 // uint32 body length + uint32 CRC of the body
+)
+
+var errLogClosed = errors.New("batchy: log is closed")
+
+// logRecord is an item record that has not been acknowledged yet
+type logRecord struct {
+	seq     uint64
+	payload []byte
+}
+
+// segmentLog is an append-only log of item records split into segment files.
+// Items are acknowledged once they no longer need to be replayed, and a
+// segment file is deleted when it and every older segment only hold
+// acknowledged items. Acks are records of their own, so deleting segments
+// strictly oldest first never loses an ack that a remaining segment needs.
+type segmentLog struct {
+	dir     string
+	fsync   bool
+	maxSize int64
+
+	mu       sync.Mutex
+	segments []*logSegment // Oldest first, the last one is being written
+	file     *os.File      // File of the last segment
+	size     int64         // Bytes written to file
+	next     uint64        // Sequence number of the next item
+	closed   bool
+
+	syncMu sync.Mutex
+	synced uint64 // Every item up to this sequence number has been fsynced
+}
+
+// logSegment tracks how many items of one segment file are not acknowledged
+type logSegment struct {
+	first uint64 // Sequence numbers of this segment start here
+	path  string
+	live  int
+}
+
+// openSegmentLog opens the log in dir, creating the directory if needed, and
+// returns the items a previous run did not acknowledge in the order they were
+// appended. New items always go to a fresh segment, a torn record at the end
+// of an old segment only ends the replay of that segment.
+func openSegmentLog(dir string, fsync bool, maxSize int64) (*segmentLog, []logRecord, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, nil, err
+	}
+	// Names are zero padded, lexical order is sequence order
+	slices.Sort(names)
+
+	l := &segmentLog{dir: dir, fsync: fsync, maxSize: maxSize, next: 1}
+	items := make(map[uint64][]byte)
+	owner := make(map[uint64]*logSegment)
+	for _, name := range names {
+		first, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg := &logSegment{first: first, path: name}
+		l.segments = append(l.segments, seg)
+		// Never reuse the name of an existing segment, it may hold acks
+		l.next = max(l.next, first+1)
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for len(data) >= recordHeader {
+			n := binary.LittleEndian.Uint32(data)
+			if uint64(len(data)-recordHeader) < uint64(n) {
+				break
+			}
+			body := data[recordHeader : recordHeader+int(n)]
+			if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[4:]) || len(body) == 0 {
+				break
+			}
+			data = data[recordHeader+int(n):]
+			switch body[0] {
+			case recordItem:
+				seq, k := binary.Uvarint(body[1:])
+				if k <= 0 {
+					continue
+				}
+				items[seq] = body[1+k:]
+				owner[seq] = seg
+				seg.live++
+				l.next = max(l.next, seq+1)
+			case recordAck:
+				for rest := body[1:]; len(rest) > 0; {
+					seq, k := binary.Uvarint(rest)
+					if k <= 0 {
+						break
+					}
+					rest = rest[k:]
+					if seg, ok := owner[seq]; ok {
+						delete(items, seq)
+						delete(owner, seq)
+						seg.live--
+					}
+				}
+			}
+		}
+	}
+
+	pending := make([]logRecord, 0, len(items))
+	for seq, payload := range items {
+		pending = append(pending, logRecord{seq: seq, payload: payload})
+	}
+	slices.SortFunc(pending, func(a, b logRecord) int {
+		if a.seq < b.seq {
+			return -1
+		}
+		if a.seq > b.seq {
+			return 1
+		}
+		return 0
+	})
+
+	if err := l.createSegment(); err != nil {
+		return nil, nil, err
+	}
+	l.synced = l.next - 1
+	l.truncate()
+	return l, pending, nil
+}
+
+// append writes one item record and returns its sequence number. With fsync
+// set it returns once the record is on stable storage; concurrent appends
+// share a single fsync.
+func (l *segmentLog) append(payload []byte) (uint64, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return 0, errLogClosed
+	}
+	seq := l.next
+	body := make([]byte, 1, 1+binary.MaxVarintLen64+len(payload))
+	body[0] = recordItem
+	body = binary.AppendUvarint(body, seq)
+	body = append(body, payload...)
+	if err := l.write(body); err != nil {
+		l.mu.Unlock()
+		return 0, err
+	}
+	l.next++
+	l.segments[len(l.segments)-1].live++
+	l.mu.Unlock()
+
+	if !l.fsync {
+		return seq, nil
+	}
+	return seq, l.syncTo(seq)
+}
+
+// ack marks items as no longer needed and deletes segments that became
+// obsolete. Acks are never fsynced: losing one only causes a redelivery.
+func (l *segmentLog) ack(seqs []uint64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errLogClosed
+	}
+	body := make([]byte, 1, 1+len(seqs)*binary.MaxVarintLen64)
+	body[0] = recordAck
+	for _, seq := range seqs {
+		body = binary.AppendUvarint(body, seq)
+	}
+	if err := l.write(body); err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		// Segments cover contiguous ranges, find the last one starting at or before seq
+		i := sort.Search(len(l.segments), func(i int) bool {
+			return l.segments[i].first > seq
+		}) - 1
+		if i >= 0 && l.segments[i].live > 0 {
+			l.segments[i].live--
+		}
+	}
+	l.truncate()
+	return nil
+}
+
+// write frames body and appends it to the current segment, starting a new
+// segment first when the current one is full. Caller holds mu.
+func (l *segmentLog) write(body []byte) error {
+	if l.size > 0 && l.size+int64(recordHeader+len(body)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(appendFrame(nil, body))
+	l.size += int64(n)
+	return err
+}
+
+// appendFrame appends body prefixed with its length and checksum to dst
+func appendFrame(dst, body []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(body)))
+	dst = binary.LittleEndian.AppendUint32(dst, crc32.ChecksumIEEE(body))
+	return append(dst, body...)
+}
+
+// rotate closes the current segment and starts the next one. Caller holds mu.
+func (l *segmentLog) rotate() error {
+	if l.fsync {
+		// Pending syncTo calls may find the file closed, this covers them
+		if err := l.file.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if err := l.createSegment(); err != nil {
+		return err
+	}
+	l.truncate()
+	return nil
+}
+
+// createSegment starts a segment whose first sequence number is next
+func (l *segmentLog) createSegment() error {
+	if n := len(l.segments); n > 0 && l.segments[n-1].first >= l.next {
+		// The current segment only holds acks, skip a sequence number so
+		// that the new segment gets a name of its own
+		l.next = l.segments[n-1].first + 1
+	}
+	path := filepath.Join(l.dir, fmt.Sprintf("%020d%s", l.next, segmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	l.file = f
+	l.size = 0
+	l.segments = append(l.segments, &logSegment{first: l.next, path: path})
+	return nil
+}
+
+// truncate deletes fully acknowledged segments from the front of the log,
+// the segment being written is always kept. Caller holds mu.
+func (l *segmentLog) truncate() {
+	for len(l.segments) > 1 && l.segments[0].live == 0 {
+		// A file that cannot be removed is retried by the next run
+		_ = os.Remove(l.segments[0].path)
+		l.segments[0] = nil
+		l.segments = l.segments[1:]
+	}
+}
+
+// syncTo fsyncs the current segment unless another call already covered seq
+func (l *segmentLog) syncTo(seq uint64) error {
+	l.syncMu.Lock()
+	defer l.syncMu.Unlock()
+	if l.synced >= seq {
+		return nil
+	}
+	l.mu.Lock()
+	upto, f, closed := l.next-1, l.file, l.closed
+	l.mu.Unlock()
+	if closed {
+		// close() synced the file
+		return nil
+	}
+	// A rotated file was synced before it was closed
+	if err := f.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	l.synced = upto
+	return nil
+}
+
+// close syncs and closes the current segment, later appends and acks fail
+func (l *segmentLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	var err error
+	if l.fsync {
+		err = l.file.Sync()
+	}
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
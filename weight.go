@@ -0,0 +1,54 @@
+package batchy
+
+import "errors"
+
+var (
+	// ErrItemTooLarge is returned for an item heavier than MaxBatchWeight
+	// under OVERSIZE_REJECT
+	ErrItemTooLarge = errors.New("batchy: item weight exceeds MaxBatchWeight")
+	// ErrWeightFuncNotSet is returned when MaxBatchWeight is set without WithWeight
+	ErrWeightFuncNotSet = errors.New("MaxBatchWeight requires a weight function, see WithWeight")
+	// ErrInvalidOversizePolicy is returned for an unknown OversizePolicy
+	ErrInvalidOversizePolicy = errors.New("invalid oversize policy")
+)
+
+// OversizePolicy defines what happens to a single item heavier than MaxBatchWeight
+type OversizePolicy int
+
+const (
+	// OVERSIZE_EMIT_ALONE processes the item in a batch of its own (default)
+	OVERSIZE_EMIT_ALONE OversizePolicy = iota
+	// OVERSIZE_REJECT rejects the item with ErrItemTooLarge when it is added
+	OVERSIZE_REJECT
+)
+
+func (p OversizePolicy) valid() bool {
+	return p >= OVERSIZE_EMIT_ALONE && p <= OVERSIZE_REJECT
+}
+
+// WithWeight sets the function that measures an item, typically its encoded
+// size in bytes. Together with BatchConfig.MaxBatchWeight it caps the total
+// weight of every batch.
+func WithWeight[T any](weightFn func(T) int) Option[T] {
+	return func(o *options[T]) {
+		o.weightFn = weightFn
+	}
+}
+
+// weigh records the weight of e and rejects it if it can never fit a batch
+func (c *ChanBatcherInstance[T]) weigh(e *entry[T]) error {
+	if c.weightFn == nil {
+		return nil
+	}
+	e.weight = max(c.weightFn(e.item), 0)
+	if c.maxBatchWeight > 0 && e.weight > c.maxBatchWeight && c.oversizePolicy == OVERSIZE_REJECT {
+		return ErrItemTooLarge
+	}
+	return nil
+}
+
+// overweight reports whether adding weight to a buffer that already holds
+// held items of total weight bufWeight would push it over MaxBatchWeight
+func (c *ChanBatcherInstance[T]) overweight(held, bufWeight, weight int) bool {
+	return c.maxBatchWeight > 0 && held > 0 && bufWeight+weight > c.maxBatchWeight
+}
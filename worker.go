@@ -0,0 +1,607 @@
+package batchy
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// batchWorker holds the state owned by a single worker goroutine
+type batchWorker[T any] struct {
+	c    *ChanBatcherInstance[T]
+	id   int
+	slot *workerSlot
+	// queue is the channel this worker receives from
+	queue chan entry[T]
+	// timeout is this worker's jittered flush timeout, computed once per limits
+	timeout time.Duration
+	limits  *limits
+	timer   *time.Timer
+	// buffer accumulates entries until a batch is emitted
+	buffer    []entry[T]
+	bufWeight int         // Total weight of buffer when WithWeight is used
+	bufIndex  map[any]int // Position of each coalescing key in buffer
+	// items and enqueued are scratch space handed to the processor, reused
+	// between batches
+	items    []T
+	enqueued []time.Time
+	// Set while a processor call this worker gave up on is still running
+	stuck atomic.Bool
+	// retries holds failed entries waiting for their backoff to expire
+	retries       []entry[T]
+	retryTimer    *time.Timer
+	lastBatchTime time.Time
+	// Keyed batchers buffer per key in groups instead of in buffer
+	groups      map[any]*keyGroup[T]
+	opened      []openedKey // Open keys, oldest first, may hold stale records
+	keySeq      uint64
+	keyDeadline time.Time // Deadline the timer is armed for, zero when disarmed
+}
+
+// worker runs the loop of one worker until the batcher stops. A panic that
+// escapes the loop is reported and the loop restarted with the same state, so
+// the batcher never silently loses workers.
+func (c *ChanBatcherInstance[T]) worker(slot *workerSlot) {
+	batchSize := c.limits.Load().batchSize
+	w := &batchWorker[T]{
+		c:     c,
+		id:    slot.id,
+		slot:  slot,
+		queue: c.queues[0],
+		// Start with initial capacity, will grow as needed
+		buffer:        make([]entry[T], 0, batchSize),
+		items:         make([]T, 0, batchSize),
+		enqueued:      make([]time.Time, 0, batchSize),
+		lastBatchTime: time.Now(),
+	}
+	if c.partitioned() {
+		w.queue = c.queues[slot.id]
+	}
+	if c.keyFn != nil {
+		w.groups = make(map[any]*keyGroup[T])
+	} else if c.coalesceKey != nil {
+		w.bufIndex = make(map[any]int)
+	}
+	c.stats.workers.Add(1)
+	defer c.stats.workers.Add(-1)
+	defer c.removeSlot(slot)
+	for !w.runProtected() {
+	}
+}
+
+// runProtected runs the worker loop and reports whether it returned normally
+func (w *batchWorker[T]) runProtected() (finished bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.c.reportPanic(w.id, newPanicError(r))
+		}
+	}()
+	w.run()
+	return true
+}
+
+func (w *batchWorker[T]) run() {
+	c := w.c
+	w.timer = time.NewTimer(w.interval())
+	defer w.timer.Stop()
+	w.keyDeadline = time.Time{}
+	// Armed on demand once an entry is waiting for a retry
+	w.retryTimer = time.NewTimer(time.Hour)
+	w.retryTimer.Stop()
+	defer w.retryTimer.Stop()
+
+	for {
+		// Stop() wins over pending work, never start a new batch after it
+		if c.ctx.Err() != nil {
+			w.abandon()
+			return
+		}
+
+		// Calculate current target batch size
+		currentBatchSize := c.calculateDynamicBatchSize()
+
+		var retryC <-chan time.Time
+		if len(w.retries) > 0 {
+			retryC = w.retryTimer.C
+		}
+		if w.groups != nil {
+			// Keyed workers time out the oldest key rather than the whole buffer
+			w.armKeyTimer()
+		}
+
+		select {
+		case <-c.ctx.Done():
+			// Don't process remaining buffer on shutdown to avoid duplicate processing
+			// The Stop() method ensures proper shutdown sequence
+			w.abandon()
+			return
+		case <-c.draining:
+			// Shutdown() closed the intake, flush everything that is left
+			w.drain(currentBatchSize, -1, TRIGGER_SHUTDOWN)
+			w.abandon()
+			return
+		case <-w.slot.retire:
+			// Reconfigure() removed this worker
+			w.retire(currentBatchSize)
+			return
+		case done := <-w.slot.flush:
+			// Only what is queued right now is owed to the caller of Flush()
+			w.drain(currentBatchSize, len(w.queue), TRIGGER_FLUSH)
+			if w.groups == nil {
+				// Reset with pre-computed jittered timeout
+				w.timer.Reset(w.interval())
+			}
+			close(done)
+		case e := <-w.queue:
+			if w.groups != nil {
+				w.addKeyed(e, currentBatchSize)
+				continue
+			}
+			if c.overweight(len(w.buffer), w.bufWeight, e.weight) {
+				// e does not fit, emit what is there before it
+				w.flush(currentBatchSize, TRIGGER_WEIGHT)
+				w.timer.Reset(w.interval())
+			}
+			w.push(e)
+
+			// Check if we should process based on current batch size or adaptive threshold
+			shouldProcess := len(w.buffer) >= currentBatchSize
+			trigger := TRIGGER_SIZE
+			if !shouldProcess && c.maxBatchWeight > 0 && w.bufWeight >= c.maxBatchWeight {
+				shouldProcess = true
+				trigger = TRIGGER_WEIGHT
+			}
+			if l := c.limits.Load(); l.dynamicBatching && !shouldProcess {
+				// Also check if we've been accumulating for too long
+				elapsedSinceLastBatch := time.Since(w.lastBatchTime)
+				shouldProcess = elapsedSinceLastBatch >= l.adaptiveThreshold
+				trigger = TRIGGER_ADAPTIVE
+			}
+
+			if shouldProcess {
+				w.flush(currentBatchSize, trigger)
+				// Reset with pre-computed jittered timeout
+				w.timer.Reset(w.interval())
+			}
+		case <-retryC:
+			// Due retries join the buffer and are batched together with fresh items
+			w.collectRetries(time.Now(), currentBatchSize)
+			if len(w.buffer) >= currentBatchSize {
+				w.flush(currentBatchSize, TRIGGER_SIZE)
+				w.timer.Reset(w.interval())
+			}
+			w.armRetryTimer()
+		case <-w.timer.C:
+			if w.groups != nil {
+				w.keyDeadline = time.Time{}
+				w.expireKeys(time.Now(), currentBatchSize)
+				continue
+			}
+			if len(w.buffer) > 0 {
+				w.flush(currentBatchSize, TRIGGER_TIMEOUT)
+			}
+			// Reset with pre-computed jittered timeout
+			w.timer.Reset(w.interval())
+		}
+	}
+}
+
+// flush processes the whole buffer in batches of at most batchSize
+func (w *batchWorker[T]) flush(batchSize int, trigger FlushTrigger) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	retrying := len(w.retries)
+	w.emit(w.buffer, batchSize, trigger)
+	clear(w.buffer)
+	w.buffer = w.buffer[:0]
+	w.bufWeight = 0
+	clear(w.bufIndex)
+	if w.groups != nil {
+		w.flushKeys(batchSize, trigger)
+	}
+	w.lastBatchTime = time.Now()
+	if len(w.retries) != retrying {
+		w.armRetryTimer()
+	}
+}
+
+// emit processes entries in batches of at most batchSize, none heavier than
+// MaxBatchWeight unless it holds a single oversized item
+func (w *batchWorker[T]) emit(entries []entry[T], batchSize int, trigger FlushTrigger) {
+	// A batch size below one would never move past the first entry
+	batchSize = max(batchSize, 1)
+	for start := 0; start < len(entries); {
+		end, weight := start, 0
+		for end < len(entries) && end-start < batchSize {
+			if w.c.overweight(end-start, weight, entries[end].weight) {
+				break
+			}
+			weight += entries[end].weight
+			end++
+		}
+		w.process(entries[start:end], trigger)
+		start = end
+	}
+}
+
+// process hands one batch to the processor and settles its entries from the
+// returned error slice: successes and permanent failures resolve their
+// futures, retryable failures are parked until their backoff expires (or
+// retried in place when order matters) and permanent failures are handed to
+// the dead-letter sink.
+func (w *batchWorker[T]) process(batch []entry[T], trigger FlushTrigger) {
+	c := w.c
+	fallback, probe, ok := w.admit()
+	if !ok {
+		// Stopped while the breaker held the batch
+		c.fail(batch, ErrBatcherStopped)
+		return
+	}
+	fn := c.processor
+	if fallback {
+		fn = c.fallback
+	}
+	w.items = w.items[:0]
+	w.enqueued = w.enqueued[:0]
+	for i := range batch {
+		w.items = append(w.items, batch[i].item)
+		w.enqueued = append(w.enqueued, batch[i].enqueuedAt)
+	}
+	c.stats.batches[trigger].Add(1)
+	c.stats.inFlight.Add(1)
+	ctx := c.ctx
+	var endSpan func(BatchInfo)
+	if c.tracer != nil {
+		ctx, endSpan = w.startSpan(batch, trigger)
+	}
+	timeout := c.limits.Load().processTimeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	errs := w.call(ctx, fn, batch, Batch[T]{
+		ID:         c.batchSeq.Add(1),
+		WorkerID:   w.id,
+		Trigger:    trigger,
+		Items:      w.items,
+		EnqueuedAt: w.enqueued,
+	}, timeout)
+	now := time.Now()
+	c.stats.inFlight.Add(-1)
+	c.stats.observeLatency(now.Sub(start))
+	c.stats.busy.Add(int64(now.Sub(start)))
+	clear(w.items)
+
+	settled, failed, reported := 0, 0, 0
+	var deadItems []T
+	var deadErrs []error
+	var acked []uint64
+	var again []entry[T] // Retried before the worker moves on, see retryInPlace
+	for i := range batch {
+		e := &batch[i]
+		var err error
+		if i < len(errs) {
+			err = errs[i]
+		}
+		if err != nil {
+			reported++
+		}
+		if err != nil && w.shouldRetry(e, err) {
+			e.attempt++
+			e.retryAt = now.Add(c.retryBackoff(e.attempt))
+			if c.ordered() {
+				again = append(again, *e)
+			} else {
+				w.retries = append(w.retries, *e)
+			}
+			c.stats.retried.Add(uint64(e.settles()))
+			continue
+		}
+		if err != nil {
+			failed += e.settles()
+		}
+		if err != nil && c.deadLetter != nil {
+			deadItems = append(deadItems, e.item)
+			deadErrs = append(deadErrs, err)
+		}
+		acked = e.walSeqs(acked)
+		if e.future != nil {
+			e.future.resolve(err)
+		}
+		for i := range e.merged {
+			if f := e.merged[i].future; f != nil {
+				f.resolve(err)
+			}
+		}
+		settled += e.settles()
+	}
+	if len(acked) > 0 {
+		// Failed acks only cause a redelivery after a restart
+		_ = c.wal.ack(acked)
+	}
+	if c.breaker != nil && !fallback {
+		w.breakerChanged(c.breaker.record(now, len(batch), reported, probe))
+	}
+	if c.latency != nil && !fallback {
+		oldest := batch[0].enqueuedAt
+		for i := range batch[1:] {
+			if batch[1+i].enqueuedAt.Before(oldest) {
+				oldest = batch[1+i].enqueuedAt
+			}
+		}
+		c.latency.observe(now.Sub(start), now.Sub(oldest), len(batch))
+	}
+	c.pending.Add(-int64(settled))
+	c.stats.processed.Add(uint64(settled - failed))
+	c.stats.failed.Add(uint64(failed))
+
+	if c.observer != nil || endSpan != nil {
+		info := BatchInfo{
+			WorkerID: w.id,
+			Size:     len(batch),
+			Trigger:  trigger,
+			Duration: now.Sub(start),
+			Failed:   reported,
+		}
+		if endSpan != nil {
+			w.safely(func() { endSpan(info) })
+		}
+		if c.observer != nil {
+			w.safely(func() { c.observer.ObserveBatch(info) })
+		}
+	}
+
+	if len(deadItems) > 0 {
+		w.safely(func() { c.deadLetter.DeadLetter(deadItems, deadErrs) })
+	}
+	if len(again) > 0 {
+		w.retryInPlace(again, trigger)
+	}
+}
+
+// retryInPlace waits out the backoff of the failed entries of a batch and
+// processes them again before the worker takes anything else, so that under
+// ORDERED_SEQUENTIAL and KEY_HASH no later item overtakes a failed one
+func (w *batchWorker[T]) retryInPlace(batch []entry[T], trigger FlushTrigger) {
+	c := w.c
+	due := batch[0].retryAt
+	for _, e := range batch[1:] {
+		if e.retryAt.After(due) {
+			due = e.retryAt
+		}
+	}
+	timer := time.NewTimer(time.Until(due))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.ctx.Done():
+		c.fail(batch, ErrBatcherStopped)
+		return
+	}
+	w.process(batch, trigger)
+}
+
+// invoke calls the processor fn, turning a panic into a PanicError for every
+// item of the batch so the worker survives and the batch can be dead-lettered
+func (w *batchWorker[T]) invoke(ctx context.Context, fn ContextProcessor[T], batch Batch[T]) (errs []error) {
+	defer func() {
+		if r := recover(); r != nil {
+			perr := newPanicError(r)
+			w.c.reportPanic(w.id, perr)
+			errs = make([]error, len(batch.Items))
+			for i := range errs {
+				errs[i] = perr
+			}
+		}
+	}()
+	return fn(ctx, batch)
+}
+
+// startSpan asks the tracer for a span covering the processor call of batch
+// and returns the context the processor runs with
+func (w *batchWorker[T]) startSpan(batch []entry[T], trigger FlushTrigger) (ctx context.Context, end func(BatchInfo)) {
+	links := make([]context.Context, 0, len(batch))
+	for i := range batch {
+		links = append(links, batch[i].ctx)
+		for j := range batch[i].merged {
+			links = append(links, batch[i].merged[j].ctx)
+		}
+	}
+	info := BatchInfo{WorkerID: w.id, Size: len(batch), Trigger: trigger}
+	w.safely(func() {
+		if t, ok := w.c.tracer.(BatchContextTracer); ok {
+			ctx, end = t.StartBatchContext(w.c.ctx, info, links)
+			return
+		}
+		end = w.c.tracer.StartBatch(w.c.ctx, info, links)
+	})
+	if ctx == nil {
+		ctx = w.c.ctx
+	}
+	return ctx, end
+}
+
+// safely runs a user supplied hook, a panicking hook is reported but cannot
+// take the worker down
+func (w *batchWorker[T]) safely(hook func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.c.reportPanic(w.id, newPanicError(r))
+		}
+	}()
+	hook()
+}
+
+// reportPanic passes a recovered panic to the OnPanic hook, if any
+func (c *ChanBatcherInstance[T]) reportPanic(workerID int, err *PanicError) {
+	if c.onPanic == nil {
+		return
+	}
+	// A broken hook must not turn a recovered panic into a crash
+	defer func() {
+		_ = recover()
+	}()
+	c.onPanic(workerID, err)
+}
+
+// drain processes the buffer, due retries and up to limit queued items
+// (everything when limit is negative) in batches of at most batchSize. With a
+// negative limit it also waits for the remaining retries to become due, so
+// nothing is left behind when Shutdown() returns.
+func (w *batchWorker[T]) drain(batchSize, limit int, trigger FlushTrigger) {
+	c := w.c
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	w.collectRetries(time.Now(), batchSize)
+	for {
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		empty := false
+		for taken := len(w.buffer); !empty && limit != 0 && taken < batchSize; taken++ {
+			select {
+			case e := <-w.queue:
+				w.stage(e, batchSize)
+				limit--
+			default:
+				empty = true
+			}
+		}
+
+		if len(w.buffer) > 0 || len(w.groups) > 0 {
+			w.flush(batchSize, trigger)
+		}
+		if !empty && limit != 0 {
+			continue
+		}
+		if limit >= 0 || len(w.retries) == 0 {
+			return
+		}
+
+		// Only Shutdown() gets here: wait for the next retry to become due
+		w.armRetryTimer()
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-w.retryTimer.C:
+		}
+		w.collectRetries(time.Now(), batchSize)
+	}
+}
+
+// stage buffers e without checking the flush triggers, keyed workers still
+// emit a key as soon as it is full
+func (w *batchWorker[T]) stage(e entry[T], batchSize int) {
+	if w.groups != nil {
+		w.addKeyed(e, batchSize)
+		return
+	}
+	w.push(e)
+}
+
+// push appends e to the buffer, or merges it into the buffered entry with
+// the same coalescing key
+func (w *batchWorker[T]) push(e entry[T]) {
+	if merged, delta := w.coalesce(w.bufIndex, w.buffer, &e); merged {
+		w.bufWeight += delta
+		return
+	}
+	w.buffer = append(w.buffer, e)
+	w.bufWeight += e.weight
+}
+
+// collectRetries moves retries that are due by now into the buffer
+func (w *batchWorker[T]) collectRetries(now time.Time, batchSize int) {
+	var due []entry[T]
+	waiting := w.retries[:0]
+	for _, e := range w.retries {
+		if e.retryAt.After(now) {
+			waiting = append(waiting, e)
+		} else if w.groups != nil {
+			// Staged after the loop, emitting a key may queue new retries
+			due = append(due, e)
+		} else {
+			w.push(e)
+		}
+	}
+	clear(w.retries[len(waiting):])
+	w.retries = waiting
+	for _, e := range due {
+		w.stage(e, batchSize)
+	}
+}
+
+// armRetryTimer schedules the retry timer for the earliest waiting retry
+func (w *batchWorker[T]) armRetryTimer() {
+	if !w.retryTimer.Stop() {
+		select {
+		case <-w.retryTimer.C:
+		default:
+		}
+	}
+	if len(w.retries) == 0 {
+		return
+	}
+	next := w.retries[0].retryAt
+	for _, e := range w.retries[1:] {
+		if e.retryAt.Before(next) {
+			next = e.retryAt
+		}
+	}
+	w.retryTimer.Reset(time.Until(next))
+}
+
+// abandon drops everything the worker still holds once the batcher is stopped
+func (w *batchWorker[T]) abandon() {
+	w.c.fail(w.buffer, ErrBatcherStopped)
+	w.buffer = w.buffer[:0]
+	w.bufWeight = 0
+	clear(w.bufIndex)
+	w.c.fail(w.retries, ErrBatcherStopped)
+	w.retries = w.retries[:0]
+	if w.groups != nil {
+		w.abandonKeys()
+	}
+}
+
+// shouldRetry reports whether e gets another attempt after failing with err,
+// a panicking classifier counts as not retryable
+func (w *batchWorker[T]) shouldRetry(e *entry[T], err error) (retry bool) {
+	c := w.c
+	// A panicking batch is never replayed automatically
+	if e.attempt+1 >= c.limits.Load().maxAttempts || errors.Is(err, ErrProcessorPanic) {
+		return false
+	}
+	if c.isRetryable == nil {
+		return true
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			w.c.reportPanic(w.id, newPanicError(r))
+			retry = false
+		}
+	}()
+	return c.isRetryable(err)
+}
+
+// retryBackoff returns the delay before attempt number failures+1: exponential
+// growth from retryBackoffBase capped at retryBackoffMax, with equal jitter so
+// items failed by the same batch do not come back in lockstep
+func (c *ChanBatcherInstance[T]) retryBackoff(failures int) time.Duration {
+	l := c.limits.Load()
+	d := l.retryBackoffMax
+	if shift := failures - 1; shift < 32 {
+		if exp := l.retryBackoffBase << shift; exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}